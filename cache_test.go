@@ -0,0 +1,123 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStorage_CacheIndex(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+		CacheIndex:      true,
+		CacheMetadata:   true,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := writeTestLogs(t, storage, 30)
+
+	if err := storage.TruncateFront(5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := storage.TruncateBack(20); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected = append(expected[:21], writeTestLogs(t, storage, 5)...)
+
+	check := func(storage Storage) {
+		if storage.FirstIndex() != 5 || storage.LastIndex() != 25 {
+			t.Errorf("expected range to be 5 - 25, got %d - %d", storage.FirstIndex(), storage.LastIndex())
+		}
+
+		for i := 5; i < len(expected); i++ {
+			readData, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(readData) != string(expected[i]) {
+				t.Errorf("expected log %d to be %s, got %s", i, expected[i], readData)
+			}
+		}
+
+		if _, err := storage.Read(26); err == nil {
+			t.Errorf("expected error on reading log which does not exist")
+		}
+	}
+
+	check(storage)
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// cached records were same with the files
+	storage, err = NewStorage(Options{Path: path, SegmentFileSize: 128})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	check(storage)
+}
+
+// BenchmarkReadCached compares reading logs with and without index and metadata cached on memory
+func BenchmarkReadCached(b *testing.B) {
+	for _, cache := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cache_%t", cache), func(b *testing.B) {
+			path := "./tmp"
+			createTempDir(path)
+			defer deleteAllFilesOnDir(path)
+
+			options := Options{
+				Path:          path,
+				CacheIndex:    cache,
+				CacheMetadata: cache,
+			}
+			storage, err := NewStorage(options)
+			if err != nil {
+				b.Fatalf("expected no error, got %v", err)
+			}
+			defer storage.Close()
+
+			const count = 1024
+			writeTestLogs(b, storage, count)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := storage.Read(int64(i % count)); err != nil {
+					b.Fatalf("expected no error, got %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/entry"
+)
+
+// ErrChainBroken is returned when hash of log does not match with the hash chain
+var ErrChainBroken = errors.New("hash chain is broken")
+
+// ChainError describes the first log of which hash does not match with the hash chain.
+// it wraps ErrChainBroken, so callers can check it with errors.Is.
+type ChainError struct {
+	Index  int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%s. index %d, %s", ErrChainBroken, e.Index, e.Reason)
+}
+
+func (e *ChainError) Unwrap() error {
+	return ErrChainBroken
+}
+
+// HeadHash returns index and chaining hash of the last log for external anchoring.
+// hash is nil if the last log is not chained or storage is empty.
+func (s *storage) HeadHash() (int64, []byte) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.indexFile.LastIndex(), append([]byte(nil), s.headHash...)
+}
+
+// verifyChunkLogs is the number of logs verified while storage is locked for reading
+const verifyChunkLogs = 1024
+
+// Verify walks hash chain of logs from index of from to index of to, and returns ChainError of the first broken link.
+// hash of log of from is trusted as anchor if the log before it was removed by TruncateFront.
+// logs are verified in chunks, and storage is locked for reading only while each chunk is verified.
+func (s *storage) Verify(from, to int64) error {
+	var prev []byte
+	for begin := from; ; begin += verifyChunkLogs {
+		end := begin + verifyChunkLogs - 1
+		if end > to || end < begin {
+			end = to
+		}
+
+		hash, err := s.verifyChunk(from, to, begin, end, prev)
+		if err != nil {
+			return err
+		}
+
+		if end >= to {
+			return nil
+		}
+		prev = hash
+	}
+}
+
+// verifyChunk verifies logs from index of begin to index of end, chained from hash of prev.
+// returns hash of log of end to chain the next chunk.
+func (s *storage) verifyChunk(from, to, begin, end int64, prev []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if err := s.checkClosed("verify"); err != nil {
+		return nil, err
+	}
+
+	// range is checked on every chunk, since logs may be truncated while lock is released
+	first, last := s.indexFile.FirstIndex(), s.indexFile.LastIndex()
+	if begin < 0 {
+		return nil, newError("verify", s.options.Path, ErrNotFound).WithIndex(begin)
+	}
+
+	if begin < first {
+		return nil, newError("verify", s.options.Path, ErrCompacted).WithIndex(begin)
+	}
+
+	if to > last {
+		return nil, newError("verify", s.options.Path, ErrNotFound).WithIndex(to)
+	}
+
+	if from > to {
+		return nil, fmt.Errorf("invalid range. %d - %d", from, to)
+	}
+
+	// the first log of storage is chained from empty hash, and logs of the next chunks from the previous chunk
+	anchored := begin > from || from == 0
+	if begin == from && from > first {
+		m, err := s.readMetadataOfIndex(from - 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata. %w", err)
+		}
+		prev, anchored = m.Hash, true
+	}
+
+	for i := begin; i <= end; i++ {
+		m, err := s.readMetadataOfIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata. %w", err)
+		}
+
+		if m.Hash == nil {
+			return nil, &ChainError{Index: i, Reason: "log has no hash"}
+		}
+
+		if anchored {
+			hash, err := s.chainHash(prev, i, m.LogMetadata)
+			if err != nil {
+				return nil, err
+			}
+
+			if !bytes.Equal(hash, m.Hash) {
+				return nil, &ChainError{Index: i, Reason: "hash does not match"}
+			}
+		}
+
+		prev, anchored = m.Hash, true
+	}
+	return prev, nil
+}
+
+// chainHash computes chaining hash of log of index i from stored payload of its fragments
+func (s *storage) chainHash(prev []byte, i int64, logMetadata []entry.LogMetadata) ([]byte, error) {
+	fragments := make([][]byte, 0, len(logMetadata))
+	for _, m := range logMetadata {
+		log, err := s.readLog(m)
+		if err != nil {
+			return nil, readLogError(s.options.Path, i, m, err)
+		}
+		fragments = append(fragments, log.PayLoad)
+	}
+	return entry.ChainHash(prev, i, fragments...), nil
+}
+
+// loadHeadHash loads hash of the last log to chain logs written after it
+func (s *storage) loadHeadHash() error {
+	s.headHash = nil
+	last := s.indexFile.LastIndex()
+	if last < s.indexFile.FirstIndex() {
+		return nil
+	}
+
+	m, err := s.readMetadataOfIndex(last)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of the last log. %w", err)
+	}
+
+	s.headHash = m.Hash
+	return nil
+}
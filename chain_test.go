@@ -0,0 +1,372 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ISSuh/wal/internal/crc"
+	"github.com/ISSuh/wal/internal/entry"
+)
+
+func TestStorage_HashChain(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+		HashChain:       true,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, hash := storage.HeadHash(); hash != nil {
+		t.Errorf("expected no hash on empty storage, got %x", hash)
+	}
+
+	writeTestLogs(t, storage, 10)
+	if _, _, err := storage.WriteBatch([][]byte{[]byte("batch 0"), []byte("batch 1")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	last, head := storage.HeadHash()
+	if last != 11 || len(head) != entry.HashByteLen {
+		t.Errorf("expected hash of log 11, got %d %x", last, head)
+	}
+
+	if err := storage.Verify(0, 11); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// head hash is loaded when storage is reopened
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if _, reopened := storage.HeadHash(); !bytes.Equal(reopened, head) {
+		t.Errorf("expected head hash %x, got %x", head, reopened)
+	}
+
+	writeTestLogs(t, storage, 5)
+	if err := storage.Verify(0, storage.LastIndex()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// head hash goes back to the hash of the last log after truncated
+	if err := storage.TruncateBack(11); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, truncated := storage.HeadHash(); !bytes.Equal(truncated, head) {
+		t.Errorf("expected head hash %x, got %x", head, truncated)
+	}
+
+	// log of from is trusted as anchor after front of logs is removed
+	if err := storage.TruncateFront(5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, storage, 5)
+	if err := storage.Verify(5, storage.LastIndex()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := storage.Verify(4, storage.LastIndex()); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected error %v, got %v", ErrCompacted, err)
+	}
+	if err := storage.Verify(5, storage.LastIndex()+1); err == nil {
+		t.Errorf("expected error on verifying logs out of range")
+	}
+}
+
+func TestStorage_VerifyConcurrentWrite(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path, HashChain: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writeTestLogs(t, storage, 3*verifyChunkLogs)
+	last := storage.LastIndex()
+
+	// writers are not blocked while logs of several chunks are verified
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := storage.Write([]byte("concurrent")); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	if err := storage.Verify(0, last); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := storage.Verify(verifyChunkLogs-1, storage.LastIndex()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestRebuild_HashChain(t *testing.T) {
+	options := Options{
+		Path:            "./tmp",
+		SegmentFileSize: 128,
+		HashChain:       true,
+	}
+
+	for _, first := range []int64{0, 3} {
+		t.Run(fmt.Sprintf("From_%d", first), func(t *testing.T) {
+			createTempDir(options.Path)
+			defer deleteAllFilesOnDir(options.Path)
+
+			storage, err := NewStorage(options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			writeTestLogs(t, storage, 10)
+			if _, _, err := storage.WriteBatch([][]byte{[]byte("batch 0"), []byte("batch 1")}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := storage.TruncateFront(first); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			last, head := storage.HeadHash()
+			storage.Close()
+
+			if _, err := Rebuild(options.Path); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			storage, err = NewStorage(options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer storage.Close()
+
+			if index, hash := storage.HeadHash(); index != last || !bytes.Equal(hash, head) {
+				t.Errorf("expected head hash %x of log %d, got %x of log %d", head, last, hash, index)
+			}
+			if err := storage.Verify(first, storage.LastIndex()); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRebuild_HashChainTampered(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path, SegmentFileSize: 128, HashChain: true}
+	st, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, st, 10)
+
+	// tamper payload of log 3 with valid crc, and lose the last index
+	m, err := st.(*storage).readMetadataOfIndex(3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	st.Close()
+
+	l := m.LogMetadata[0]
+	segmentPath := fmt.Sprintf("%s/segment_%d", path, l.SegmentID)
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	payload := data[l.Offset+entry.LogHeaderByteLen : l.Offset+entry.LogHeaderByteLen+int64(l.Size)]
+	payload[0] ^= 0xff
+	binary.BigEndian.PutUint32(data[l.Offset+24:l.Offset+28], crc.Encode(payload))
+	if err := os.WriteFile(segmentPath, data, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := os.Stat(path + "/index")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.Truncate(path+"/index", info.Size()-20); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	saved := make(map[string][]byte)
+	for _, name := range []string{"index", "metadata"} {
+		data, err := os.ReadFile(path + "/" + name)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		saved[name] = data
+	}
+
+	for _, rebuild := range []func(string) (RebuildReport, error){Rebuild, ForceRebuild} {
+		var chainErr *ChainError
+		if _, err := rebuild(path); !errors.As(err, &chainErr) || chainErr.Index != 3 {
+			t.Fatalf("expected broken link on log 3, got %v", err)
+		}
+	}
+
+	// old files are kept
+	for name, data := range saved {
+		current, err := os.ReadFile(path + "/" + name)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Equal(current, data) {
+			t.Errorf("expected %s not to be replaced", name)
+		}
+	}
+
+	st, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer st.Close()
+
+	var chainErr *ChainError
+	if err := st.Verify(0, st.LastIndex()); !errors.As(err, &chainErr) || chainErr.Index != 3 {
+		t.Errorf("expected broken link on log 3, got %v", err)
+	}
+}
+
+func TestStorage_HashChainTampered(t *testing.T) {
+	options := func(path string) Options {
+		return Options{Path: path, SegmentFileSize: 128, HashChain: true}
+	}
+
+	tamper := func(t *testing.T, path string, fn func(s *storage)) Storage {
+		st, err := NewStorage(options(path))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		writeTestLogs(t, st, 10)
+
+		fn(st.(*storage))
+		st.Close()
+
+		st, err = NewStorage(options(path))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return st
+	}
+
+	modify := func(t *testing.T, filePath string, offset int64) {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		data[offset] ^= 0xff
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	t.Run("payload", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		storage := tamper(t, path, func(s *storage) {
+			m, err := s.readMetadataOfIndex(4)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			l := m.LogMetadata[0]
+			modify(t, fmt.Sprintf("%s/segment_%d", path, l.SegmentID), l.Offset+entry.LogHeaderByteLen)
+		})
+		defer storage.Close()
+
+		var chainErr *ChainError
+		if err := storage.Verify(0, 9); !errors.As(err, &chainErr) || chainErr.Index != 4 {
+			t.Errorf("expected broken link on log 4, got %v", err)
+		}
+		if err := storage.Verify(5, 9); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		storage := tamper(t, path, func(s *storage) {
+			i, err := s.indexFile.Read(6)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			position := i.MetadataOffset - s.metadataFile.BaseOffset() + 16 + int64(i.MetadataSize) - 1
+			modify(t, path+"/metadata", position)
+		})
+		defer storage.Close()
+
+		var chainErr *ChainError
+		if err := storage.Verify(0, 9); !errors.As(err, &chainErr) || chainErr.Index != 6 {
+			t.Errorf("expected broken link on log 6, got %v", err)
+		}
+	})
+
+	t.Run("not chained", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		storage, err := NewStorage(Options{Path: path})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+		writeTestLogs(t, storage, 3)
+
+		if err := storage.Verify(0, 2); !errors.Is(err, ErrChainBroken) {
+			t.Errorf("expected error %v, got %v", ErrChainBroken, err)
+		}
+	})
+}
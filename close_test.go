@@ -0,0 +1,178 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStorage_CloseConcurrent(t *testing.T) {
+	for _, groupCommit := range []bool{false, true} {
+		path := "./tmp"
+		createTempDir(path)
+
+		storage, err := NewStorage(Options{
+			Path:            path,
+			SegmentFileSize: 1024,
+			MmapSegments:    true,
+			GroupCommit:     groupCommit,
+			SyncPolicy:      SyncPolicy{Mode: SyncInterval, Interval: time.Millisecond},
+			Retention:       RetentionPolicy{MaxLogs: 500},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var wg sync.WaitGroup
+		unexpected := make(chan error, 16)
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for {
+					if _, err := storage.Write([]byte("test data")); err != nil {
+						if !errors.Is(err, ErrClosed) {
+							unexpected <- err
+						}
+						return
+					}
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+				for {
+					_, err := storage.Read(storage.LastIndex())
+					switch {
+					case errors.Is(err, ErrClosed):
+						return
+					case err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrCompacted):
+						unexpected <- err
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := storage.WaitFor(context.Background(), 1<<40); !errors.Is(err, ErrClosed) {
+				unexpected <- err
+			}
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		if err := storage.Close(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		wg.Wait()
+
+		close(unexpected)
+		for err := range unexpected {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+		deleteAllFilesOnDir(path)
+	}
+}
+
+func TestStorage_CloseTwice(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path, SyncPolicy: SyncPolicy{Mode: SyncOnRollOnly}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	writeTestLogs(t, storage, 10)
+	if storage.SyncedIndex() == storage.LastIndex() {
+		t.Fatalf("expected logs not synced before close")
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// logs are synced on close
+	if storage.SyncedIndex() != 9 {
+		t.Errorf("expected synced index to be 9, got %d", storage.SyncedIndex())
+	}
+
+	calls := map[string]func() error{
+		"close": storage.Close,
+		"sync":  storage.Sync,
+		"write": func() error {
+			_, err := storage.Write([]byte("test"))
+			return err
+		},
+		"read": func() error {
+			_, err := storage.Read(0)
+			return err
+		},
+		"view": func() error {
+			return storage.View(0, func([]byte) error { return nil })
+		},
+		"iterator": func() error {
+			_, err := storage.NewIterator(0)
+			return err
+		},
+		"truncate front": func() error {
+			return storage.TruncateFront(1)
+		},
+		"truncate back": func() error {
+			return storage.TruncateBack(1)
+		},
+		"info": func() error {
+			_, err := storage.Info()
+			return err
+		},
+		"verify": func() error {
+			return storage.Verify(0, 9)
+		},
+		"wait": func() error {
+			return storage.WaitFor(context.Background(), 0)
+		},
+	}
+
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: expected %v, got %v", name, ErrClosed, err)
+		}
+	}
+
+	entries, cancel := storage.Subscribe(0)
+	for range entries {
+		t.Errorf("expected no entry from closed storage")
+	}
+	if err := cancel(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ISSuh/wal"
+)
+
+func dump(args []string) error {
+	flags, sf := newFlagSet("dump")
+	from := flags.Int64("from", -1, "index of the first log to print. default is the first log")
+	to := flags.Int64("to", -1, "index of the last log to print. default is the last log")
+	format := flags.String("format", "text", "output format. text, hex or json")
+	flags.Parse(args)
+
+	var printLog func(w io.Writer, index int64, data []byte) error
+	switch *format {
+	case "text":
+		printLog = printText
+	case "hex":
+		printLog = printHex
+	case "json":
+		printLog = printJSON
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+
+	storage, err := sf.openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	if *from < 0 {
+		*from = storage.FirstIndex()
+	}
+	if *to < 0 {
+		*to = storage.LastIndex()
+	}
+
+	if *from > *to {
+		return nil
+	}
+
+	it, err := storage.NewIterator(*from)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() && it.Index() <= *to {
+		if err := printLog(os.Stdout, it.Index(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func printText(w io.Writer, index int64, data []byte) error {
+	_, err := fmt.Fprintf(w, "%d\t%s\n", index, data)
+	return err
+}
+
+func printHex(w io.Writer, index int64, data []byte) error {
+	_, err := fmt.Fprintf(w, "%d (%d bytes)\n%s", index, len(data), hex.Dump(data))
+	return err
+}
+
+// printJSON prints log as a json line. payload which is json is embedded as it is, or encoded as base64.
+func printJSON(w io.Writer, index int64, data []byte) error {
+	line := struct {
+		Index int64           `json:"index"`
+		Size  int             `json:"size"`
+		Data  json.RawMessage `json:"data,omitempty"`
+		Bytes []byte          `json:"bytes,omitempty"`
+	}{
+		Index: index,
+		Size:  len(data),
+	}
+
+	if len(data) > 0 && json.Valid(data) {
+		line.Data = data
+	} else {
+		line.Bytes = data
+	}
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", encoded)
+	return err
+}
+
+// readAll reads every log of storage with fn. reading is stopped at the first error.
+func readAll(storage wal.Storage, fn func(index int64, data []byte)) error {
+	first, last := storage.FirstIndex(), storage.LastIndex()
+	if first > last {
+		return nil
+	}
+
+	it, err := storage.NewIterator(first)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() && it.Index() <= last {
+		fn(it.Index(), it.Value())
+	}
+	return it.Err()
+}
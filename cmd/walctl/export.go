@@ -0,0 +1,123 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ISSuh/wal"
+)
+
+func export(args []string) error {
+	flags, sf := newFlagSet("export")
+	from := flags.Int64("from", -1, "index of the first log to export. default is the first log")
+	to := flags.Int64("to", -1, "index of the last log to export. default is the last log")
+	format := flags.String("format", "jsonl", "output format. jsonl or binary")
+	out := flags.String("out", "", "file to write logs. default is stdout")
+	flags.Parse(args)
+
+	exportFormat, err := parseExportFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	storage, err := sf.openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	if *from < 0 {
+		*from = storage.FirstIndex()
+	}
+	if *to < 0 {
+		*to = storage.LastIndex()
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := storage.Export(w, *from, *to, exportFormat)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported logs: %d\n", count)
+	return nil
+}
+
+func importLogs(args []string) error {
+	flags, sf := newFlagSet("import")
+	in := flags.String("in", "", "file to read logs. default is stdin")
+	flags.Parse(args)
+
+	options, err := sf.options()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	storage, err := wal.NewStorage(options)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	count, err := storage.Import(r)
+	fmt.Printf("imported logs: %d\n", count)
+	if err != nil {
+		return err
+	}
+	return storage.Sync()
+}
+
+func parseExportFormat(format string) (wal.ExportFormat, error) {
+	switch format {
+	case "jsonl":
+		return wal.ExportJSONL, nil
+	case "binary":
+		return wal.ExportBinary, nil
+	default:
+		return 0, fmt.Errorf("unknown format %s", format)
+	}
+}
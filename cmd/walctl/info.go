@@ -0,0 +1,57 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+)
+
+func info(args []string) error {
+	flags, sf := newFlagSet("info")
+	flags.Parse(args)
+
+	storage, err := sf.openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	info, err := storage.Info()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("first index: %d\n", info.FirstIndex)
+	fmt.Printf("last index: %d\n", info.LastIndex)
+	fmt.Printf("logs: %d\n", info.LastIndex-info.FirstIndex+1)
+	fmt.Printf("segments: %d\n", len(info.Segments))
+	for _, seg := range info.Segments {
+		fmt.Printf("  segment %d: %d bytes\n", seg.ID, seg.Size)
+	}
+	fmt.Printf("index size: %d bytes\n", info.IndexSize)
+	fmt.Printf("metadata size: %d bytes\n", info.MetadataSize)
+	fmt.Printf("total size: %d bytes\n", info.TotalSize())
+	return nil
+}
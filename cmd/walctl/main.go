@@ -0,0 +1,180 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ISSuh/wal"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "info", usage: "print range of logs and sizes of files", run: info},
+	{name: "dump", usage: "print logs in range as text, hex or json", run: dump},
+	{name: "verify", usage: "check crc of every log from index to segment", run: verify},
+	{name: "stats", usage: "print statistics of logs and files", run: stats},
+	{name: "export", usage: "write logs in range as json lines or binary stream", run: export},
+	{name: "import", usage: "append logs written by export. fails if storage is opened by writer", run: importLogs},
+	{name: "repair", usage: "discard torn tail of files. fails if storage is opened by writer", run: repair},
+	{name: "rebuild", usage: "rebuild index and metadata files from segment files", run: rebuild},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "walctl %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: walctl <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+// storageFlags are flags to open storage, shared by commands
+type storageFlags struct {
+	path string
+	keys keysFlag
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *storageFlags) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	sf := &storageFlags{}
+	flags.StringVar(&sf.path, "path", "", "directory of the log files")
+	flags.Var(&sf.keys, "key", "key to decrypt logs as id:hex. can be repeated, and the last one is the current key")
+	return flags, sf
+}
+
+func (sf *storageFlags) options() (wal.Options, error) {
+	if sf.path == "" {
+		return wal.Options{}, fmt.Errorf("path is required")
+	}
+
+	options := wal.Options{Path: sf.path}
+	if len(sf.keys.Keys) > 0 {
+		options.Encryption = sf.keys.StaticKeys
+	}
+	return options, nil
+}
+
+// openReadOnly opens storage for reading without changing files, so it can run against storage used by writer
+func (sf *storageFlags) openReadOnly() (wal.Storage, error) {
+	options, err := sf.options()
+	if err != nil {
+		return nil, err
+	}
+
+	options.ReadOnly = true
+	return wal.NewStorage(options)
+}
+
+// keysFlag collects keys of id:hex
+type keysFlag struct {
+	wal.StaticKeys
+}
+
+func (k *keysFlag) String() string {
+	return ""
+}
+
+func (k *keysFlag) Set(value string) error {
+	idText, keyText, found := strings.Cut(value, ":")
+	if !found {
+		return fmt.Errorf("key must be id:hex")
+	}
+
+	id, err := strconv.ParseUint(idText, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid key id. %w", err)
+	}
+
+	key, err := hex.DecodeString(keyText)
+	if err != nil {
+		return fmt.Errorf("invalid key. %w", err)
+	}
+
+	if k.Keys == nil {
+		k.Keys = make(map[uint32][]byte)
+	}
+	k.Keys[uint32(id)] = key
+	k.Current = uint32(id)
+	return nil
+}
+
+func rebuild(args []string) error {
+	flags := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	path := flags.String("path", "", "directory of the log files")
+	force := flags.Bool("force", false, "replace files even if scanning stopped at broken log")
+	flags.Parse(args)
+
+	if *path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	run := wal.Rebuild
+	if *force {
+		run = wal.ForceRebuild
+	}
+
+	report, err := run(*path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("scanned segments: %d\n", report.Segments)
+	fmt.Printf("rebuilt logs: %d - %d\n", report.FirstIndex, report.LastIndex)
+	if report.Err != nil {
+		fmt.Printf("scanning stopped: %v\n", report.Err)
+	}
+	return nil
+}
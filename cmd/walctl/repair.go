@@ -0,0 +1,81 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ISSuh/wal"
+)
+
+// repair opens storage for writing, so torn tail of files is discarded by recovery.
+// it fails with wal.ErrLocked while other process writes on storage.
+func repair(args []string) error {
+	flags, sf := newFlagSet("repair")
+	truncateCorrupted := flags.Bool("truncate-corrupted", false, "remove the first corrupted log and all logs after it")
+	flags.Parse(args)
+
+	options, err := sf.options()
+	if err != nil {
+		return err
+	}
+
+	storage, err := wal.NewStorage(options)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	report := storage.Recovery()
+	fmt.Printf("last index: %d\n", report.LastIndex)
+	fmt.Printf("discarded logs: %d\n", report.DiscardedLogs)
+	fmt.Printf("truncated bytes: index %d, metadata %d, segment %d\n",
+		report.TruncatedIndexBytes, report.TruncatedMetadataBytes, report.TruncatedSegmentBytes)
+	if len(report.RemovedSegments) > 0 {
+		fmt.Printf("removed segments: %v\n", report.RemovedSegments)
+	}
+	if report.Rebuilt {
+		fmt.Println("index and metadata rebuilt from segments")
+	}
+
+	if !*truncateCorrupted {
+		return nil
+	}
+
+	for i := storage.FirstIndex(); i <= storage.LastIndex(); i++ {
+		_, err := storage.Read(i)
+		if !errors.Is(err, wal.ErrCorrupted) {
+			continue
+		}
+
+		if err := storage.TruncateBack(i - 1); err != nil {
+			return err
+		}
+		fmt.Printf("truncated corrupted logs from %d\n", i)
+		break
+	}
+	return nil
+}
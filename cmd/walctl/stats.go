@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+)
+
+func stats(args []string) error {
+	flags, sf := newFlagSet("stats")
+	flags.Parse(args)
+
+	storage, err := sf.openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	info, err := storage.Info()
+	if err != nil {
+		return err
+	}
+
+	count, total, minSize, maxSize := 0, 0, 0, 0
+	err = readAll(storage, func(index int64, data []byte) {
+		size := len(data)
+		if count == 0 || size < minSize {
+			minSize = size
+		}
+		if size > maxSize {
+			maxSize = size
+		}
+		count++
+		total += size
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("logs: %d\n", count)
+	fmt.Printf("segments: %d\n", len(info.Segments))
+	fmt.Printf("payload size: %d bytes\n", total)
+	fmt.Printf("total size: %d bytes\n", info.TotalSize())
+	if count == 0 {
+		return nil
+	}
+
+	fmt.Printf("log size: min %d, max %d, avg %.1f bytes\n", minSize, maxSize, float64(total)/float64(count))
+	fmt.Printf("logs per segment: %.1f\n", float64(count)/float64(len(info.Segments)))
+	if total > 0 {
+		fmt.Printf("size on disk per payload: %.2f\n", float64(info.TotalSize())/float64(total))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ISSuh/wal"
+)
+
+func verify(args []string) error {
+	flags, sf := newFlagSet("verify")
+	chain := flags.Bool("chain", false, "verify hash chain of logs too")
+	flags.Parse(args)
+
+	storage, err := sf.openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// every log is read one by one to report all corrupted logs
+	first, last := storage.FirstIndex(), storage.LastIndex()
+	corrupted := 0
+	for i := first; i <= last; i++ {
+		_, err := storage.Read(i)
+		var corruption *wal.Error
+		switch {
+		case errors.Is(err, wal.ErrCorrupted) && errors.As(err, &corruption) && corruption.SegmentID >= 0:
+			corrupted++
+			fmt.Printf("corrupted log %d on segment %d at offset %d\n", corruption.Index, corruption.SegmentID, corruption.Offset)
+		case err != nil:
+			corrupted++
+			fmt.Printf("failed to read log %d: %v\n", i, err)
+		}
+	}
+
+	fmt.Printf("verified logs: %d - %d\n", first, last)
+	if corrupted > 0 {
+		return fmt.Errorf("%d logs are corrupted", corrupted)
+	}
+
+	if *chain && first <= last {
+		if err := storage.Verify(first, last); err != nil {
+			return err
+		}
+
+		index, hash := storage.HeadHash()
+		fmt.Printf("hash chain is valid. head hash of log %d: %x\n", index, hash)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CodecID identifies codec which compressed payload of log. it is recorded on the header of every log.
+type CodecID uint8
+
+const (
+	// CodecNone stores payload as it is
+	CodecNone CodecID = iota
+
+	// CodecS2 compresses payload with s2, which is fast and compatible with snappy
+	CodecS2
+
+	// CodecZstd compresses payload with zstd, which has higher ratio
+	CodecZstd
+)
+
+// ErrUnknownCodec is returned when log was compressed with codec which is not registered
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Codec compresses payload of log before it is written on segment.
+// custom codec is registered with RegisterCodec, and must be registered before storage is opened.
+type Codec interface {
+	// ID returns identifier recorded on the header of log compressed by codec
+	ID() CodecID
+
+	// Encode appends compressed src to dst and returns it
+	Encode(dst, src []byte) ([]byte, error)
+
+	// Decode appends decompressed src to dst and returns it
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+var (
+	codecMutex sync.RWMutex
+	codecs     = map[CodecID]Codec{
+		CodecNone: noneCodec{},
+		CodecS2:   s2Codec{},
+		CodecZstd: &zstdCodec{},
+	}
+)
+
+// RegisterCodec registers codec to compress and decompress logs. id of codec must not be registered already.
+func RegisterCodec(codec Codec) error {
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+
+	if _, exist := codecs[codec.ID()]; exist {
+		return fmt.Errorf("codec %d is already registered", codec.ID())
+	}
+
+	codecs[codec.ID()] = codec
+	return nil
+}
+
+func codecOf(id CodecID) (Codec, error) {
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+
+	codec, exist := codecs[id]
+	if !exist {
+		return nil, fmt.Errorf("%w. %d", ErrUnknownCodec, id)
+	}
+	return codec, nil
+}
+
+// compress compresses data with codec. data is stored as it is if compression does not reduce size.
+func compress(codec Codec, data []byte) ([]byte, CodecID, error) {
+	if codec.ID() == CodecNone || len(data) == 0 {
+		return data, CodecNone, nil
+	}
+
+	compressed, err := codec.Encode(nil, data)
+	if err != nil {
+		return nil, CodecNone, fmt.Errorf("failed to compress data. %w", err)
+	}
+
+	if len(compressed) >= len(data) {
+		return data, CodecNone, nil
+	}
+	return compressed, codec.ID(), nil
+}
+
+// decompress decompresses data compressed with codec of id
+func decompress(id CodecID, data []byte) ([]byte, error) {
+	if id == CodecNone {
+		return data, nil
+	}
+
+	codec, err := codecOf(id)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Decode(nil, data)
+}
+
+type noneCodec struct{}
+
+func (noneCodec) ID() CodecID {
+	return CodecNone
+}
+
+func (noneCodec) Encode(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func (noneCodec) Decode(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+type s2Codec struct{}
+
+func (s2Codec) ID() CodecID {
+	return CodecS2
+}
+
+func (s2Codec) Encode(dst, src []byte) ([]byte, error) {
+	return append(dst, s2.Encode(nil, src)...), nil
+}
+
+func (s2Codec) Decode(dst, src []byte) ([]byte, error) {
+	decoded, err := s2.Decode(nil, src)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, decoded...), nil
+}
+
+// zstdCodec creates encoder and decoder on first use. they are safe for concurrent use.
+type zstdCodec struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (c *zstdCodec) ID() CodecID {
+	return CodecZstd
+}
+
+func (c *zstdCodec) Encode(dst, src []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.encoder.EncodeAll(src, dst), nil
+}
+
+func (c *zstdCodec) Decode(dst, src []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.decoder.DecodeAll(src, dst)
+}
+
+func (c *zstdCodec) init() error {
+	c.once.Do(func() {
+		c.encoder, c.err = zstd.NewWriter(nil)
+		if c.err != nil {
+			return
+		}
+		c.decoder, c.err = zstd.NewReader(nil)
+	})
+	return c.err
+}
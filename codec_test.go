@@ -0,0 +1,260 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// xorCodec is custom codec for test, which does not reduce size
+type xorCodec struct{}
+
+func (xorCodec) ID() CodecID {
+	return 100
+}
+
+func (xorCodec) Encode(dst, src []byte) ([]byte, error) {
+	for _, b := range src {
+		dst = append(dst, b^0xff)
+	}
+	return dst, nil
+}
+
+func (xorCodec) Decode(dst, src []byte) ([]byte, error) {
+	return xorCodec{}.Encode(dst, src)
+}
+
+// rleCodec is custom codec for test, which encodes runs of same byte as count and byte
+type rleCodec struct{}
+
+func (rleCodec) ID() CodecID {
+	return 101
+}
+
+func (rleCodec) Encode(dst, src []byte) ([]byte, error) {
+	for i := 0; i < len(src); {
+		run := 1
+		for i+run < len(src) && src[i+run] == src[i] && run < 255 {
+			run++
+		}
+		dst = append(dst, byte(run), src[i])
+		i += run
+	}
+	return dst, nil
+}
+
+func (rleCodec) Decode(dst, src []byte) ([]byte, error) {
+	if len(src)%2 != 0 {
+		return nil, errors.New("invalid rle data")
+	}
+	for i := 0; i < len(src); i += 2 {
+		dst = append(dst, bytes.Repeat(src[i+1:i+2], int(src[i]))...)
+	}
+	return dst, nil
+}
+
+func init() {
+	if err := RegisterCodec(rleCodec{}); err != nil {
+		panic(err)
+	}
+}
+
+func writeCompressibleLogs(t testing.TB, storage Storage, count int) [][]byte {
+	expected := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := []byte(fmt.Sprintf(`{"index":%d,"data":"%s"}`, i, bytes.Repeat([]byte("a"), 100+i)))
+		if _, err := storage.Write(data); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected = append(expected, data)
+	}
+	return expected
+}
+
+func TestStorage_Compression(t *testing.T) {
+	for _, codec := range []CodecID{CodecNone, CodecS2, CodecZstd} {
+		t.Run(fmt.Sprintf("codec_%d", codec), func(t *testing.T) {
+			path := "./tmp"
+			createTempDir(path)
+			defer deleteAllFilesOnDir(path)
+
+			options := Options{
+				Path:            path,
+				SegmentFileSize: 128,
+				Compression:     codec,
+			}
+			storage, err := NewStorage(options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer storage.Close()
+
+			expected := writeCompressibleLogs(t, storage, 20)
+			expected = append(expected, writeTestLogs(t, storage, 5)...)
+			for i, data := range expected {
+				readData, err := storage.Read(int64(i))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if string(readData) != string(data) {
+					t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+				}
+
+				err = storage.View(int64(i), func(viewData []byte) error {
+					if string(viewData) != string(data) {
+						t.Errorf("expected log %d to be %s, got %s", i, data, viewData)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+
+			it, err := storage.NewIterator(0)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer it.Close()
+
+			for i := 0; it.Next(); i++ {
+				if string(it.Value()) != string(expected[i]) {
+					t.Errorf("expected log %d to be %s, got %s", i, expected[i], it.Value())
+				}
+			}
+			if err := it.Err(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStorage_CompressionReducesSize(t *testing.T) {
+	sizes := map[CodecID]int64{}
+	for _, codec := range []CodecID{CodecNone, CodecS2, CodecZstd} {
+		path := "./tmp"
+		createTempDir(path)
+
+		storage, err := NewStorage(Options{Path: path, Compression: codec})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		writeCompressibleLogs(t, storage, 20)
+		storage.Close()
+
+		info, err := os.Stat(path + "/segment_0")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		sizes[codec] = info.Size()
+		deleteAllFilesOnDir(path)
+	}
+
+	if sizes[CodecS2] >= sizes[CodecNone] || sizes[CodecZstd] >= sizes[CodecNone] {
+		t.Errorf("expected compressed segments to be smaller, got %v", sizes)
+	}
+}
+
+func TestStorage_MixedCompression(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	expected := make([][]byte, 0)
+	for _, codec := range []CodecID{CodecZstd, CodecNone, rleCodec{}.ID(), CodecS2} {
+		storage, err := NewStorage(Options{Path: path, SegmentFileSize: 256, Compression: codec})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected = append(expected, writeCompressibleLogs(t, storage, 5)...)
+		for i, data := range expected {
+			readData, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(readData) != string(data) {
+				t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+			}
+		}
+
+		if err := storage.Close(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	if err := RegisterCodec(xorCodec{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := RegisterCodec(xorCodec{}); err == nil {
+		t.Errorf("expected error on registering codec twice")
+	}
+	if err := RegisterCodec(noneCodec{}); err == nil {
+		t.Errorf("expected error on registering built-in codec")
+	}
+
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	if _, err := NewStorage(Options{Path: path, Compression: 200}); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("expected error %v, got %v", ErrUnknownCodec, err)
+	}
+
+	storage, err := NewStorage(Options{Path: path, Compression: rleCodec{}.ID()})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	// payload is written with custom codec
+	data := []byte("aaaaaaaabbbbbbbb")
+	index, err := storage.Write(data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	readData, err := storage.Read(index)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != string(data) {
+		t.Errorf("expected %s, got %s", data, readData)
+	}
+
+	segmentData, err := os.ReadFile(path + "/segment_0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.HasSuffix(segmentData, []byte("\x08a\x08b")) {
+		t.Errorf("expected payload to be compressed by custom codec")
+	}
+}
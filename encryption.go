@@ -0,0 +1,152 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	keyIDByteLen = 4
+	nonceByteLen = 12
+)
+
+// ErrKeyNotFound is returned by KeyProvider when key of id does not exist
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyProvider supplies keys of AES-GCM which encrypt payload of logs.
+// length of key must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+// id of key is stored on every encrypted log, so old keys must be kept while logs encrypted with them remain.
+type KeyProvider interface {
+	// CurrentKey returns id and key which encrypt new logs
+	CurrentKey() (uint32, []byte, error)
+
+	// Key returns key of id which decrypts logs encrypted with it
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeys is KeyProvider of fixed keys. keys are rotated by adding new key and changing Current.
+type StaticKeys struct {
+	Current uint32
+	Keys    map[uint32][]byte
+}
+
+func (k StaticKeys) CurrentKey() (uint32, []byte, error) {
+	key, err := k.Key(k.Current)
+	if err != nil {
+		return 0, nil, err
+	}
+	return k.Current, key, nil
+}
+
+func (k StaticKeys) Key(id uint32) ([]byte, error) {
+	key, exist := k.Keys[id]
+	if !exist {
+		return nil, fmt.Errorf("%w. %d", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// encrypt seals data with the current key. index of log is authenticated together,
+// so encrypted payload can not be moved to other log.
+// Layout of encrypted payload:
+// +-------------+-------------+----- ... ----+----------+
+// | KeyID (4B)  | Nonce (12B) |  Ciphertext  | Tag (16B)|
+// +-------------+-------------+----- ... ----+----------+
+func encrypt(keys KeyProvider, index int64, data []byte) ([]byte, error) {
+	keyID, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current key. %w", err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, keyIDByteLen+nonceByteLen, keyIDByteLen+nonceByteLen+len(data)+aead.Overhead())
+	binary.BigEndian.PutUint32(buf[0:keyIDByteLen], keyID)
+
+	nonce := buf[keyIDByteLen : keyIDByteLen+nonceByteLen]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce. %w", err)
+	}
+
+	return aead.Seal(buf, nonce, data, additionalData(index, keyID)), nil
+}
+
+// decrypt opens data encrypted by encrypt. returns ErrCorrupted if data is not authenticated.
+func decrypt(keys KeyProvider, index int64, data []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, errors.New("log is encrypted but key provider is not set")
+	}
+
+	if len(data) < keyIDByteLen+nonceByteLen {
+		return nil, fmt.Errorf("%w. encrypted payload size %d", ErrCorrupted, len(data))
+	}
+
+	keyID := binary.BigEndian.Uint32(data[0:keyIDByteLen])
+	key, err := keys.Key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key %d. %w", keyID, err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := data[keyIDByteLen : keyIDByteLen+nonceByteLen]
+	decrypted, err := aead.Open(nil, nonce, data[keyIDByteLen+nonceByteLen:], additionalData(index, keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w. %v", ErrCorrupted, err)
+	}
+	return decrypted, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher. %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm. %w", err)
+	}
+	return aead, nil
+}
+
+func additionalData(index int64, keyID uint32) []byte {
+	buf := make([]byte, 8+keyIDByteLen)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(index))
+	binary.BigEndian.PutUint32(buf[8:], keyID)
+	return buf
+}
@@ -0,0 +1,216 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testKeys = StaticKeys{
+	Current: 1,
+	Keys: map[uint32][]byte{
+		1: bytes.Repeat([]byte{1}, 32),
+		2: bytes.Repeat([]byte{2}, 16),
+	},
+}
+
+func TestStorage_Encryption(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+		Compression:     CodecS2,
+		Encryption:      testKeys,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeCompressibleLogs(t, storage, 10)
+	expected = append(expected, writeTestLogs(t, storage, 10)...)
+	for i, data := range expected {
+		readData, err := storage.Read(int64(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData) != string(data) {
+			t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+		}
+
+		err = storage.View(int64(i), func(viewData []byte) error {
+			if string(viewData) != string(data) {
+				t.Errorf("expected log %d to be %s, got %s", i, data, viewData)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	it, err := storage.NewIterator(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer it.Close()
+
+	for i := 0; it.Next(); i++ {
+		if string(it.Value()) != string(expected[i]) {
+			t.Errorf("expected log %d to be %s, got %s", i, expected[i], it.Value())
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// payload is not written on any file
+	files, err := filepath.Glob(path + "/*")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if bytes.Contains(data, []byte("test data")) || bytes.Contains(data, []byte(`"index"`)) {
+			t.Errorf("expected payload not to be written on %s", file)
+		}
+	}
+}
+
+func TestStorage_EncryptionKeyRotation(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	keys := StaticKeys{Current: 1, Keys: map[uint32][]byte{1: testKeys.Keys[1]}}
+	storage, err := NewStorage(Options{Path: path, Encryption: keys})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := writeTestLogs(t, storage, 5)
+	storage.Close()
+
+	// logs encrypted with old key are readable after key is rotated
+	storage, err = NewStorage(Options{Path: path, Encryption: testKeys.rotated(2)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected = append(expected, writeTestLogs(t, storage, 5)...)
+	for i, data := range expected {
+		readData, err := storage.Read(int64(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData) != string(data) {
+			t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+		}
+	}
+	storage.Close()
+
+	// logs of removed key can not be read, but they are not corrupted
+	storage, err = NewStorage(Options{Path: path, Encryption: keys})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if _, err := storage.Read(0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err = storage.Read(5)
+	if !errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected error %v, got %v", ErrKeyNotFound, err)
+	}
+}
+
+func TestStorage_EncryptionAuthentication(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:                path,
+		Encryption:          testKeys,
+		SkipCRCVerification: true,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, storage, 3)
+	storage.Close()
+
+	// flip byte of ciphertext of the first log. recovery only checks the last log
+	segmentPath := path + "/segment_0"
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	data[16+28+keyIDByteLen+nonceByteLen] ^= 0xff
+	if err := os.WriteFile(segmentPath, data, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if _, err := storage.Read(1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var corruption *Error
+	if _, err := storage.Read(0); !errors.As(err, &corruption) || corruption.Index != 0 {
+		t.Errorf("expected corruption error of log 0, got %v", err)
+	}
+
+	if _, err := NewStorage(Options{Path: path, Encryption: StaticKeys{Current: 3, Keys: testKeys.Keys}}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", ErrKeyNotFound, err)
+	}
+
+	invalid := StaticKeys{Current: 1, Keys: map[uint32][]byte{1: []byte("short")}}
+	if _, err := NewStorage(Options{Path: path, Encryption: invalid}); err == nil {
+		t.Errorf("expected error on key of invalid length")
+	}
+}
+
+// rotated returns keys of which current key is id
+func (k StaticKeys) rotated(id uint32) StaticKeys {
+	return StaticKeys{Current: id, Keys: k.Keys}
+}
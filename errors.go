@@ -0,0 +1,75 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/errs"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+var (
+	// ErrNotFound is returned when log of index has not been written
+	ErrNotFound = errs.ErrNotFound
+
+	// ErrClosed is returned when storage is closed
+	ErrClosed = errs.ErrClosed
+
+	// ErrCorrupted is returned when stored log does not match with its crc
+	ErrCorrupted = errs.ErrCorrupted
+
+	// ErrCompacted is returned when log was removed by TruncateFront
+	ErrCompacted = errs.ErrCompacted
+
+	// ErrEntryTooLarge is returned when size of log exceeds MaxEntrySize
+	ErrEntryTooLarge = errs.ErrEntryTooLarge
+
+	// ErrReadOnly is returned when storage opened as read only is changed
+	ErrReadOnly = errs.ErrReadOnly
+
+	// ErrLocked is returned when storage is opened for writing while another writer holds it
+	ErrLocked = errs.ErrLocked
+
+	// ErrEmptyBatch is returned when WriteBatch is called with no log
+	ErrEmptyBatch = errs.ErrEmptyBatch
+
+	// ErrTruncated is returned when log delivered to subscriber was removed by TruncateBack
+	ErrTruncated = errs.ErrTruncated
+)
+
+// Error describes operation, log and file of error. it wraps one of errors above or error of os,
+// so callers can check it with errors.Is, and get where it happened with errors.As.
+// Index, SegmentID and Offset are -1 if error is not of a log or segment.
+type Error = errs.Error
+
+// newError returns error of op on storage of path
+func newError(op, path string, err error) *Error {
+	return errs.New(op, path, err)
+}
+
+// corruptionError returns error of corrupted log of index i of which fragment is m on segment in path
+func corruptionError(path string, i int64, m entry.LogMetadata) error {
+	return newError("read", segment.Path(m.SegmentID, path), ErrCorrupted).WithIndex(i).WithSegment(m.SegmentID, m.Offset)
+}
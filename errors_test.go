@@ -0,0 +1,124 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStorage_Errors(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path, MaxEntrySize: 64})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	writeTestLogs(t, storage, 10)
+	if err := storage.TruncateFront(3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		err   error
+		want  error
+		index int64
+	}{
+		{name: "not written", err: readError(storage, 10), want: ErrNotFound, index: 10},
+		{name: "compacted", err: readError(storage, 2), want: ErrCompacted, index: 2},
+		{name: "truncate front", err: storage.TruncateFront(12), want: ErrNotFound, index: 12},
+		{name: "truncate back", err: storage.TruncateBack(0), want: ErrCompacted, index: 0},
+		{name: "verify", err: storage.Verify(3, 11), want: ErrNotFound, index: 11},
+		{name: "negative", err: readError(storage, -1), want: ErrNotFound, index: -1},
+		{name: "negative iterator", err: iteratorError(storage, -1), want: ErrNotFound, index: -1},
+		{name: "negative truncate back", err: storage.TruncateBack(-2), want: ErrNotFound, index: -2},
+		{name: "negative verify", err: storage.Verify(-1, 5), want: ErrNotFound, index: -1},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, tt.err)
+			continue
+		}
+
+		var walErr *Error
+		if !errors.As(tt.err, &walErr) || walErr.Index != tt.index {
+			t.Errorf("%s: expected Error of index %d, got %v", tt.name, tt.index, tt.err)
+		}
+	}
+
+	if _, err := storage.Write(bytes.Repeat([]byte("a"), 65)); !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("expected %v, got %v", ErrEntryTooLarge, err)
+	}
+	if _, _, err := storage.WriteBatch([][]byte{[]byte("a"), bytes.Repeat([]byte("a"), 65)}); !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("expected %v, got %v", ErrEntryTooLarge, err)
+	}
+	if _, _, err := storage.WriteBatch(nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Errorf("expected %v, got %v", ErrEmptyBatch, err)
+	}
+	if storage.LastIndex() != 9 {
+		t.Errorf("expected last index to be 9, got %d", storage.LastIndex())
+	}
+
+	it, err := storage.NewIterator(3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := it.SeekTo(-1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+	it.Close()
+	if err := it.SeekTo(5); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected %v, got %v", ErrClosed, err)
+	}
+	storage.Close()
+
+	readOnly, err := NewStorage(Options{Path: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer readOnly.Close()
+
+	_, err = readOnly.Write([]byte("test"))
+	var walErr *Error
+	if !errors.Is(err, ErrReadOnly) || !errors.As(err, &walErr) || walErr.Op != "write" || walErr.Path != path {
+		t.Errorf("expected %v of write on %s, got %v", ErrReadOnly, path, err)
+	}
+}
+
+func readError(storage Storage, i int64) error {
+	_, err := storage.Read(i)
+	return err
+}
+
+func iteratorError(storage Storage, from int64) error {
+	_, err := storage.NewIterator(from)
+	return err
+}
@@ -0,0 +1,372 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ISSuh/wal/internal/crc"
+)
+
+// ExportFormat is format of logs written by Export
+type ExportFormat uint8
+
+const (
+	// ExportJSONL writes a json line of index, crc and base64 payload for each log
+	ExportJSONL ExportFormat = iota
+	// ExportBinary writes stream header, then Index(8)|Length(4)|CRC(4)|Payload for each log
+	ExportBinary
+)
+
+const (
+	exportMagic          = "WALX"
+	exportVersion        = 1
+	exportHeaderByteLen  = len(exportMagic) + 1
+	exportRecordByteLen  = 16
+	importBatchLogs      = 1024
+	importBatchSizeBytes = 4 * 1024 * 1024
+
+	// exportLineOverheadByteLen is the length allowed for json line of ExportJSONL except base64 payload
+	exportLineOverheadByteLen = 128
+)
+
+// exportRecord is a line of ExportJSONL. crc is crc32 (IEEE) of payload
+type exportRecord struct {
+	Index int64  `json:"index"`
+	CRC   uint32 `json:"crc"`
+	Data  []byte `json:"data"`
+}
+
+// Export writes logs from index of from to index of to with format, and returns the number of written logs.
+// payload is written as it was given to Write, so it is independent of compression, encryption and layout of files.
+func (s *storage) Export(w io.Writer, from, to int64, format ExportFormat) (int64, error) {
+	if format != ExportJSONL && format != ExportBinary {
+		return 0, fmt.Errorf("unknown export format %d", format)
+	}
+
+	last := s.LastIndex()
+	if to > last {
+		return 0, newError("export", s.options.Path, ErrNotFound).WithIndex(to)
+	}
+
+	bw := bufio.NewWriter(w)
+	if format == ExportBinary {
+		if _, err := bw.WriteString(exportMagic); err != nil {
+			return 0, err
+		}
+		if err := bw.WriteByte(exportVersion); err != nil {
+			return 0, err
+		}
+	}
+
+	count := int64(0)
+	if from <= to {
+		it, err := s.NewIterator(from)
+		if err != nil {
+			return 0, err
+		}
+		defer it.Close()
+
+		for it.Next() && it.Index() <= to {
+			if err := writeExportRecord(bw, format, it.Index(), it.Value()); err != nil {
+				return count, fmt.Errorf("failed to export log %d. %w", it.Index(), err)
+			}
+			count++
+		}
+
+		if err := it.Err(); err != nil {
+			return count, err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+func writeExportRecord(w *bufio.Writer, format ExportFormat, i int64, data []byte) error {
+	if format == ExportJSONL {
+		encoded, err := json.Marshal(exportRecord{Index: i, CRC: crc.Encode(data), Data: data})
+		if err != nil {
+			return err
+		}
+
+		encoded = append(encoded, '\n')
+		_, err = w.Write(encoded)
+		return err
+	}
+
+	var header [exportRecordByteLen]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(i))
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[12:16], crc.Encode(data))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+// Import appends logs exported by Export, and returns the number of imported logs.
+// format is detected from the stream. indexes of logs must be continuous and
+// the first one must be the next index of storage, or any index if storage has no log.
+// crc of every log is verified while loading, and logs are written in large batches.
+// logs of batches written before an error are kept.
+func (s *storage) Import(r io.Reader) (int64, error) {
+	if s.options.ReadOnly {
+		return 0, newError("import", s.options.Path, ErrReadOnly)
+	}
+
+	br := bufio.NewReader(r)
+	next, err := detectImportFormat(br, s.options.MaxEntrySize)
+	if err != nil {
+		return 0, err
+	}
+
+	count := int64(0)
+	expected := int64(-1)
+	batch, batchSize := make([][]byte, 0, importBatchLogs), 0
+	for {
+		i, data, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read log. %w", err)
+		}
+
+		if err := s.checkEntrySize([][]byte{data}); err != nil {
+			return count, err
+		}
+
+		if expected >= 0 && i != expected {
+			return count, fmt.Errorf("index of log is not continuous. expected %d, got %d", expected, i)
+		}
+
+		if expected < 0 {
+			if err := s.prepareImport(i); err != nil {
+				return count, err
+			}
+		}
+		expected = i + 1
+
+		batch = append(batch, data)
+		batchSize += len(data)
+		if len(batch) < importBatchLogs && batchSize < importBatchSizeBytes {
+			continue
+		}
+
+		if err := s.importBatch(expected-int64(len(batch)), batch); err != nil {
+			return count, err
+		}
+		count += int64(len(batch))
+		batch, batchSize = batch[:0], 0
+	}
+
+	if len(batch) > 0 {
+		if err := s.importBatch(expected-int64(len(batch)), batch); err != nil {
+			return count, err
+		}
+		count += int64(len(batch))
+	}
+	return count, nil
+}
+
+// prepareImport checks the first index of import, and moves the first index of storage to it if storage has no log
+func (s *storage) prepareImport(i int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkClosed("import"); err != nil {
+		return err
+	}
+
+	first, last := s.indexFile.FirstIndex(), s.indexFile.LastIndex()
+	if i == last+1 {
+		return nil
+	}
+
+	if first <= last {
+		return fmt.Errorf("first index of import %d is not the next index of storage %d", i, last+1)
+	}
+
+	if err := s.syncFiles(); err != nil {
+		return err
+	}
+
+	// segment may have logs removed by truncation. switch to new segment to delete it
+	if !s.segment.Empty() {
+		if err := s.rollSegment(); err != nil {
+			return fmt.Errorf("failed to roll segment. %w", err)
+		}
+	}
+
+	if err := s.indexFile.Reset(i); err != nil {
+		return fmt.Errorf("failed to reset index file. %w", err)
+	}
+
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.loadHeadHash()
+}
+
+// importBatch writes batch of import of which the first index is first, bypassing group commit,
+// since import is the only writer of large batches. fails if another writer wrote logs while importing.
+func (s *storage) importBatch(first int64, batch [][]byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkClosed("import"); err != nil {
+		return err
+	}
+
+	if next := s.indexFile.LastIndex() + 1; next != first {
+		return fmt.Errorf("log %d of import would be written at %d. storage was written while importing", first, next)
+	}
+
+	if _, _, err := s.writeBatch(batch); err != nil {
+		return fmt.Errorf("failed to write imported logs. %w", err)
+	}
+	return nil
+}
+
+// detectImportFormat returns reader of records. stream which starts with magic is binary, or json lines.
+// payload of binary record and json line longer than payload of maxEntrySize are rejected before read,
+// if maxEntrySize is set.
+func detectImportFormat(r *bufio.Reader, maxEntrySize int) (func() (int64, []byte, error), error) {
+	magic, err := r.Peek(len(exportMagic))
+	if err != nil || string(magic) != exportMagic {
+		return readJSONLRecord(r, maxEntrySize), nil
+	}
+
+	header := make([]byte, exportHeaderByteLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read stream header. %w", err)
+	}
+
+	if version := header[len(exportMagic)]; version != exportVersion {
+		return nil, fmt.Errorf("unknown version of stream %d", version)
+	}
+	return readBinaryRecord(r, maxEntrySize), nil
+}
+
+func readJSONLRecord(r *bufio.Reader, maxEntrySize int) func() (int64, []byte, error) {
+	maxLineLen := -1
+	if maxEntrySize > 0 {
+		maxLineLen = base64.StdEncoding.EncodedLen(maxEntrySize) + exportLineOverheadByteLen
+	}
+
+	return func() (int64, []byte, error) {
+		line, err := readLine(r, maxLineLen)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var record exportRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return 0, nil, fmt.Errorf("failed to decode json line. %w", err)
+		}
+
+		if !crc.IsMatch(record.Data, record.CRC) {
+			return 0, nil, fmt.Errorf("crc of log %d does not match. %w", record.Index, ErrCorrupted)
+		}
+		return record.Index, record.Data, nil
+	}
+}
+
+func readBinaryRecord(r io.Reader, maxEntrySize int) func() (int64, []byte, error) {
+	return func() (int64, []byte, error) {
+		var header [exportRecordByteLen]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, nil, fmt.Errorf("torn record header. %w", err)
+			}
+			return 0, nil, err
+		}
+
+		i := int64(binary.BigEndian.Uint64(header[0:8]))
+		length := int64(binary.BigEndian.Uint32(header[8:12]))
+		if maxEntrySize > 0 && length > int64(maxEntrySize) {
+			return 0, nil, fmt.Errorf("log %d. %w. size %d, limit %d", i, ErrEntryTooLarge, length, maxEntrySize)
+		}
+
+		// length is not trusted to allocate at once. buffer grows as payload is read
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, length); err != nil {
+			return 0, nil, fmt.Errorf("torn payload of log %d. %w", i, noEOF(err))
+		}
+		data := buf.Bytes()
+
+		if !crc.IsMatch(data, binary.BigEndian.Uint32(header[12:16])) {
+			return 0, nil, fmt.Errorf("crc of log %d does not match. %w", i, ErrCorrupted)
+		}
+		return i, data, nil
+	}
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, since EOF in the middle of record is not end of stream
+// readLine returns the next line which is not blank, without surrounding spaces.
+// line longer than maxLen is rejected with ErrEntryTooLarge before it is fully read, unless maxLen is negative.
+func readLine(r *bufio.Reader, maxLen int) ([]byte, error) {
+	for {
+		line := make([]byte, 0)
+		for {
+			chunk, err := r.ReadSlice('\n')
+			line = append(line, chunk...)
+			if maxLen >= 0 && len(bytes.TrimSpace(line)) > maxLen {
+				return nil, fmt.Errorf("%w. json line exceeds %d bytes", ErrEntryTooLarge, maxLen)
+			}
+
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+			if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+				return nil, err
+			}
+			break
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
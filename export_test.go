@@ -0,0 +1,284 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ISSuh/wal/internal/crc"
+)
+
+func TestStorage_ExportImport(t *testing.T) {
+	for _, format := range []ExportFormat{ExportJSONL, ExportBinary} {
+		path, importPath := "./tmp", "./tmp_import"
+		createTempDir(path)
+		createTempDir(importPath)
+
+		source, err := NewStorage(Options{Path: path, SegmentFileSize: 256, Compression: CodecS2})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := writeTestLogs(t, source, 30)
+		if err := source.TruncateFront(5); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var buf bytes.Buffer
+		count, err := source.Export(&buf, 5, 29, format)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != 25 {
+			t.Errorf("expected 25 exported logs, got %d", count)
+		}
+		source.Close()
+
+		// storage which has no log starts from the first index of import
+		target, err := NewStorage(Options{Path: importPath, SegmentFileSize: 128, HashChain: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		count, err = target.Import(&buf)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != 25 {
+			t.Errorf("expected 25 imported logs, got %d", count)
+		}
+
+		if target.FirstIndex() != 5 || target.LastIndex() != 29 {
+			t.Errorf("expected range to be 5 - 29, got %d - %d", target.FirstIndex(), target.LastIndex())
+		}
+
+		for i := int64(5); i < 30; i++ {
+			data, err := target.Read(i)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !bytes.Equal(data, expected[i]) {
+				t.Errorf("expected data %s, got %s", expected[i], data)
+			}
+		}
+
+		if err := target.Verify(5, 29); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+
+		if index, err := target.Write([]byte("next")); err != nil || index != 30 {
+			t.Errorf("expected next log at 30, got %d, %v", index, err)
+		}
+
+		target.Close()
+		deleteAllFilesOnDir(path)
+		deleteAllFilesOnDir(importPath)
+	}
+}
+
+func TestStorage_Import_Invalid(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writeTestLogs(t, storage, 3)
+
+	var buf bytes.Buffer
+	if _, err := storage.Export(&buf, 0, 2, ExportJSONL); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	exported := buf.String()
+
+	// first index of import must be the next index of storage which has logs
+	if _, err := storage.Import(strings.NewReader(exported)); err == nil {
+		t.Errorf("expected error on index mismatch")
+	}
+
+	tests := map[string]string{
+		"corrupted": `{"index":3,"crc":1,"data":"dGVzdA=="}`,
+		"not continuous": `{"index":3,"crc":3632233996,"data":"dGVzdA=="}
+{"index":5,"crc":3632233996,"data":"dGVzdA=="}`,
+	}
+
+	for name, stream := range tests {
+		if _, err := storage.Import(strings.NewReader(stream)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if _, err := storage.Import(strings.NewReader(tests["corrupted"])); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted, got %v", err)
+	}
+
+	// binary stream with torn payload
+	buf.Reset()
+	if _, err := storage.Export(&buf, 2, 2, ExportBinary); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := storage.Import(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestStorage_Import_EntrySize(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path, MaxEntrySize: 8})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	// binary record claiming 4 GiB payload is rejected before allocated
+	stream := append([]byte(exportMagic), exportVersion)
+	record := make([]byte, exportRecordByteLen)
+	binary.BigEndian.PutUint32(record[8:12], math.MaxUint32)
+	stream = append(stream, record...)
+
+	if _, err := storage.Import(bytes.NewReader(stream)); !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("expected %v, got %v", ErrEntryTooLarge, err)
+	}
+
+	jsonl := `{"index":0,"crc":353998636,"data":"dGVzdCBkYXRhIDA="}`
+	if _, err := storage.Import(strings.NewReader(jsonl)); !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("expected %v, got %v", ErrEntryTooLarge, err)
+	}
+
+	// endless json line is rejected before decoded
+	endless := io.MultiReader(strings.NewReader(`{"index":0,"crc":0,"data":"`), repeatReader('A'))
+	if _, err := storage.Import(endless); !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("expected %v, got %v", ErrEntryTooLarge, err)
+	}
+
+	if storage.LastIndex() != -1 {
+		t.Errorf("expected no imported log, got last index %d", storage.LastIndex())
+	}
+
+	// json line of payload of MaxEntrySize is imported
+	data := []byte("12345678")
+	jsonl = fmt.Sprintf(`{"index":0,"crc":%d,"data":"%s"}`, crc.Encode(data), base64.StdEncoding.EncodeToString(data))
+	if _, err := storage.Import(strings.NewReader(jsonl)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if storage.LastIndex() != 0 {
+		t.Errorf("expected log 0 to be imported, got last index %d", storage.LastIndex())
+	}
+}
+
+// repeatReader reads the byte endlessly
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// writingReader calls write once after half of stream is read
+type writingReader struct {
+	r       io.Reader
+	read    int
+	trigger int
+	write   func()
+}
+
+func (r *writingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += n
+	if r.write != nil && r.read >= r.trigger {
+		r.write()
+		r.write = nil
+	}
+	return n, err
+}
+
+func TestStorage_Import_ConcurrentWrite(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 3*importBatchLogs)
+
+	var buf bytes.Buffer
+	if _, err := storage.Export(&buf, 0, storage.LastIndex(), ExportBinary); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := storage.TruncateFront(storage.LastIndex() + 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	concurrent := int64(-1)
+	r := &writingReader{
+		r:       &buf,
+		trigger: buf.Len() / 2,
+		write: func() {
+			if concurrent, err = storage.Write([]byte("concurrent")); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		},
+	}
+
+	count, err := storage.Import(r)
+	if err == nil {
+		t.Fatalf("expected error on concurrent write")
+	}
+
+	// imported logs are not shifted by concurrent write
+	if concurrent != count {
+		t.Errorf("expected concurrent log at %d, got %d", count, concurrent)
+	}
+	for i := int64(0); i < count; i++ {
+		data, err := storage.Read(i)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Equal(data, expected[i]) {
+			t.Fatalf("expected %s, got %s", expected[i], data)
+		}
+	}
+}
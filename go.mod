@@ -1,3 +1,5 @@
 module github.com/ISSuh/wal
 
 go 1.20
+
+require github.com/klauspost/compress v1.17.9
@@ -0,0 +1,195 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"sync"
+	"time"
+)
+
+// commitRequest is batch of logs queued by writer waiting for group commit
+type commitRequest struct {
+	batch [][]byte
+
+	// result of commit. valid after done is closed
+	first int64
+	last  int64
+	err   error
+
+	// lead is set when request is promoted to leader of the next group
+	lead bool
+	done chan struct{}
+}
+
+// groupCommitter queues concurrent writes and commits them together.
+// the first queued writer becomes leader, writes logs of queued writers as one batch
+// with a single flush and sync on each file, and releases every waiter with its index.
+type groupCommitter struct {
+	maxBatch int
+	maxWait  time.Duration
+	commit   func(batch [][]byte) (int64, int64, error)
+
+	mutex   sync.Mutex
+	queue   []*commitRequest
+	queued  int
+	leading bool
+
+	// full wakes leader waiting for more writers when queue reaches max batch
+	full chan struct{}
+}
+
+func newGroupCommitter(maxBatch int, maxWait time.Duration, commit func(batch [][]byte) (int64, int64, error)) *groupCommitter {
+	return &groupCommitter{
+		maxBatch: maxBatch,
+		maxWait:  maxWait,
+		commit:   commit,
+		queue:    make([]*commitRequest, 0),
+		full:     make(chan struct{}, 1),
+	}
+}
+
+// write queues batch and blocks until batch is committed by leader
+func (g *groupCommitter) write(batch [][]byte) (int64, int64, error) {
+	req := &commitRequest{
+		batch: batch,
+		done:  make(chan struct{}),
+	}
+
+	g.mutex.Lock()
+	g.queue = append(g.queue, req)
+	g.queued += len(batch)
+	if g.queued >= g.maxBatch {
+		select {
+		case g.full <- struct{}{}:
+		default:
+		}
+	}
+
+	if g.leading {
+		g.mutex.Unlock()
+		<-req.done
+		if !req.lead {
+			return req.first, req.last, req.err
+		}
+	} else {
+		g.leading = true
+		g.mutex.Unlock()
+	}
+
+	g.lead(req)
+	return req.first, req.last, req.err
+}
+
+// lead commits queued requests as a group. req is the request of leader itself.
+func (g *groupCommitter) lead(req *commitRequest) {
+	g.waitForGroup()
+
+	g.mutex.Lock()
+	group := g.takeGroup()
+	g.mutex.Unlock()
+
+	batch := make([][]byte, 0)
+	for _, r := range group {
+		batch = append(batch, r.batch...)
+	}
+
+	first, _, err := g.commit(batch)
+	for _, r := range group {
+		r.err = err
+		if err == nil {
+			r.first = first
+			r.last = first + int64(len(r.batch)) - 1
+			first = r.last + 1
+		}
+	}
+
+	// hand over leadership to the first writer queued while committing
+	g.mutex.Lock()
+	var next *commitRequest
+	if len(g.queue) > 0 {
+		next = g.queue[0]
+		next.lead = true
+	} else {
+		g.leading = false
+	}
+	g.mutex.Unlock()
+
+	for _, r := range group {
+		if r != req {
+			close(r.done)
+		}
+	}
+
+	if next != nil {
+		close(next.done)
+	}
+}
+
+// waitForGroup waits for more writers to join the group until max wait or max batch is reached
+func (g *groupCommitter) waitForGroup() {
+	if g.maxWait <= 0 {
+		return
+	}
+
+	g.mutex.Lock()
+	queued := g.queued
+	g.mutex.Unlock()
+	if queued >= g.maxBatch {
+		return
+	}
+
+	timer := time.NewTimer(g.maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-g.full:
+	}
+}
+
+// takeGroup removes requests up to max batch logs from queue.
+// the first request is always taken even if it is larger than max batch.
+func (g *groupCommitter) takeGroup() []*commitRequest {
+	count, logs := 0, 0
+	for _, r := range g.queue {
+		if count > 0 && logs+len(r.batch) > g.maxBatch {
+			break
+		}
+		count++
+		logs += len(r.batch)
+	}
+
+	group := make([]*commitRequest, count)
+	copy(group, g.queue[:count])
+	g.queue = g.queue[count:]
+	g.queued -= logs
+
+	// drop stale signal of full queue for the next leader
+	select {
+	case <-g.full:
+	default:
+	}
+	return group
+}
@@ -0,0 +1,223 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit_ConcurrentWrite(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:                path,
+		SegmentFileSize:     1 * kb,
+		SyncAfterWrite:      true,
+		GroupCommit:         true,
+		GroupCommitMaxBatch: 16,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writers, count := 8, 50
+	written := make([]map[int64][]byte, writers)
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		written[w] = make(map[int64][]byte)
+
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				data := []byte(fmt.Sprintf("writer %d log %d", w, i))
+				if i%10 == 0 {
+					first, last, err := storage.WriteBatch([][]byte{data, data})
+					if err != nil {
+						t.Errorf("expected no error, got %v", err)
+						return
+					}
+					if last != first+1 {
+						t.Errorf("expected batch of 2 logs, got %d - %d", first, last)
+					}
+					written[w][first], written[w][last] = data, data
+					continue
+				}
+
+				index, err := storage.Write(data)
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				written[w][index] = data
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, logs := range written {
+		for index, data := range logs {
+			readData, err := storage.Read(index)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !bytes.Equal(readData, data) {
+				t.Errorf("expected log %d to be %s, got %s", index, data, readData)
+			}
+		}
+		total += len(logs)
+	}
+
+	if storage.LastIndex() != int64(total-1) {
+		t.Errorf("expected last index to be %d, got %d", total-1, storage.LastIndex())
+	}
+}
+
+func TestGroupCommit_MaxBatch(t *testing.T) {
+	mutex := sync.Mutex{}
+	groups := make([]int, 0)
+	last := int64(-1)
+
+	// blocks the first group until all writers are queued
+	release := make(chan struct{})
+	committer := newGroupCommitter(4, time.Millisecond, func(batch [][]byte) (int64, int64, error) {
+		mutex.Lock()
+		groups = append(groups, len(batch))
+		blocked := len(groups) == 1
+		mutex.Unlock()
+
+		if blocked {
+			<-release
+		}
+
+		first := last + 1
+		last += int64(len(batch))
+		return first, last, nil
+	})
+
+	wg := sync.WaitGroup{}
+	write := func() {
+		defer wg.Done()
+		if _, _, err := committer.write([][]byte{[]byte("log")}); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+
+	wg.Add(1)
+	go write()
+	for {
+		mutex.Lock()
+		started := len(groups) > 0
+		mutex.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go write()
+	}
+	for {
+		committer.mutex.Lock()
+		queued := committer.queued
+		committer.mutex.Unlock()
+		if queued == 10 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	expected := []int{1, 4, 4, 2}
+	if fmt.Sprint(groups) != fmt.Sprint(expected) {
+		t.Errorf("expected groups to be %v, got %v", expected, groups)
+	}
+}
+
+func benchmarkConcurrentWrite(b *testing.B, options Options, writers int) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options.Path = path
+	storage, err := NewStorage(options)
+	if err != nil {
+		b.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	data := []byte("1")
+	wg := sync.WaitGroup{}
+
+	b.ResetTimer()
+	for w := 0; w < writers; w++ {
+		count := b.N / writers
+		if w < b.N%writers {
+			count++
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				if _, err := storage.Write(data); err != nil {
+					b.Errorf("expected no error, got %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkConcurrentWrite(b *testing.B) {
+	for _, writers := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("writers_%d", writers), func(b *testing.B) {
+			benchmarkConcurrentWrite(b, Options{SyncAfterWrite: true}, writers)
+		})
+	}
+}
+
+func BenchmarkConcurrentWriteWithGroupCommit(b *testing.B) {
+	for _, writers := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("writers_%d", writers), func(b *testing.B) {
+			benchmarkConcurrentWrite(b, Options{SyncAfterWrite: true, GroupCommit: true}, writers)
+		})
+	}
+}
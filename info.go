@@ -0,0 +1,93 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+// SegmentInfo is id and size of segment file
+type SegmentInfo struct {
+	ID   int
+	Size int64
+}
+
+// Info describes range of logs and files of storage
+type Info struct {
+	FirstIndex   int64
+	LastIndex    int64
+	Segments     []SegmentInfo
+	IndexSize    int64
+	MetadataSize int64
+}
+
+// TotalSize returns total size of index, metadata and segment files
+func (i Info) TotalSize() int64 {
+	size := i.IndexSize + i.MetadataSize
+	for _, seg := range i.Segments {
+		size += seg.Size
+	}
+	return size
+}
+
+// Info returns range of logs and sizes of files
+func (s *storage) Info() (Info, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if err := s.checkClosed("info"); err != nil {
+		return Info{}, err
+	}
+
+	info := Info{
+		FirstIndex: s.indexFile.FirstIndex(),
+		LastIndex:  s.indexFile.LastIndex(),
+	}
+
+	var err error
+	if info.IndexSize, err = s.indexFile.Size(); err != nil {
+		return Info{}, fmt.Errorf("failed to get size of index file. %w", err)
+	}
+
+	if info.MetadataSize, err = s.metadataFile.Size(); err != nil {
+		return Info{}, fmt.Errorf("failed to get size of metadata file. %w", err)
+	}
+
+	segmentIDs, err := segment.List(s.options.Path)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	for _, id := range segmentIDs {
+		stat, err := segment.Stat(id, s.options.Path)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to get size of segment %d. %w", id, err)
+		}
+		info.Segments = append(info.Segments, SegmentInfo{ID: id, Size: stat.Size()})
+	}
+	return info, nil
+}
@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestStorage_Info(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path, SegmentFileSize: 128})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writeTestLogs(t, storage, 20)
+	if err := storage.TruncateFront(5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := storage.Info()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if info.FirstIndex != 5 || info.LastIndex != 19 {
+		t.Errorf("expected range to be 5 - 19, got %d - %d", info.FirstIndex, info.LastIndex)
+	}
+	if info.IndexSize != 20+15*20 {
+		t.Errorf("expected index size to be %d, got %d", 20+15*20, info.IndexSize)
+	}
+
+	total := info.IndexSize + info.MetadataSize
+	for _, seg := range info.Segments {
+		stat, err := os.Stat(fmt.Sprintf("%s/segment_%d", path, seg.ID))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if stat.Size() != seg.Size {
+			t.Errorf("expected size of segment %d to be %d, got %d", seg.ID, stat.Size(), seg.Size)
+		}
+		total += seg.Size
+	}
+
+	if info.TotalSize() != total {
+		t.Errorf("expected total size to be %d, got %d", total, info.TotalSize())
+	}
+}
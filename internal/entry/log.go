@@ -24,9 +24,56 @@ SOFTWARE.
 
 package entry
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/crc"
+)
+
+const (
+	// LogMagic is the magic number at the beginning of every log on segment. "WALL"
+	LogMagic = 0x57414c4c
+
+	// LogHeaderByteLen is size of the header written before payload of log
+	LogHeaderByteLen = 28
+
+	// LogFlagsOffset is offset of flags in the header of log
+	LogFlagsOffset = 4
+
+	// LogCodecOffset is offset of id of codec which compressed payload in the header of log
+	LogCodecOffset = 5
+)
+
+const (
+	// FlagFirstFragment marks the first fragment of log
+	FlagFirstFragment uint8 = 1 << iota
+
+	// FlagLastFragment marks the last fragment of log
+	FlagLastFragment
+
+	// FlagBatchContinued marks log followed by another log written in the same batch
+	FlagBatchContinued
+
+	// FlagEncrypted marks log of which payload is encrypted
+	FlagEncrypted
+)
+
+// ErrInvalidLog is returned when encoded log does not have valid header
+var ErrInvalidLog = errors.New("invalid log")
+
+// Layout of encoded Log:
+// +------------+------------+------------+---------------+------------+----------------+-------------+-----------+----- ... ----+
+// | Magic (4B) | Flags (1B) | Codec (1B) | Reserved (2B) | Index (8B) | Sequence (4B)  | Length (4B) | CRC (4B)  |   Payload    |
+// +------------+------------+------------+---------------+------------+----------------+-------------+-----------+----- ... ----+
+// payload is stored as compressed by codec, and crc is of the stored payload.
 type Log struct {
 	Index    int64
 	Sequence int
+	Flags    uint8
+	Codec    uint8
+	CRC      uint32
 	PayLoad  []byte
 }
 
@@ -38,15 +85,79 @@ func NewLog(index int64, sequence int, payload []byte) Log {
 	}
 }
 
+// IsFirstFragment reports whether log is the first fragment of log
+func (l Log) IsFirstFragment() bool {
+	return l.Flags&FlagFirstFragment != 0
+}
+
+// IsLastFragment reports whether log is the last fragment of log
+func (l Log) IsLastFragment() bool {
+	return l.Flags&FlagLastFragment != 0
+}
+
+// IsEncrypted reports whether payload of log is encrypted
+func (l Log) IsEncrypted() bool {
+	return l.Flags&FlagEncrypted != 0
+}
+
+// IsBatchContinued reports whether log is followed by another log written in the same batch
+func (l Log) IsBatchContinued() bool {
+	return l.Flags&FlagBatchContinued != 0
+}
+
 func EncodeLog(log Log) []byte {
-	buf := make([]byte, 0)
+	buf := make([]byte, LogHeaderByteLen, LogHeaderByteLen+len(log.PayLoad))
+	binary.BigEndian.PutUint32(buf[0:4], LogMagic)
+	buf[LogFlagsOffset] = log.Flags
+	buf[LogCodecOffset] = log.Codec
+	binary.BigEndian.PutUint64(buf[8:16], uint64(log.Index))
+	binary.BigEndian.PutUint32(buf[16:20], uint32(log.Sequence))
+	binary.BigEndian.PutUint32(buf[20:24], uint32(len(log.PayLoad)))
+	binary.BigEndian.PutUint32(buf[24:28], crc.Encode(log.PayLoad))
 	buf = append(buf, log.PayLoad...)
 	return buf
 }
 
+// DecodeLogHeader decodes header of log and returns log without payload and length of payload
+func DecodeLogHeader(data []byte) (Log, int, error) {
+	if len(data) < LogHeaderByteLen {
+		return Log{}, 0, fmt.Errorf("%w. header size %d", ErrInvalidLog, len(data))
+	}
+
+	if magic := binary.BigEndian.Uint32(data[0:4]); magic != LogMagic {
+		return Log{}, 0, fmt.Errorf("%w. magic %x", ErrInvalidLog, magic)
+	}
+
+	log := Log{
+		Flags:    data[LogFlagsOffset],
+		Codec:    data[LogCodecOffset],
+		Index:    int64(binary.BigEndian.Uint64(data[8:16])),
+		Sequence: int(binary.BigEndian.Uint32(data[16:20])),
+		CRC:      binary.BigEndian.Uint32(data[24:28]),
+	}
+	length := int(binary.BigEndian.Uint32(data[20:24]))
+	return log, length, nil
+}
+
 func DecodeLog(data []byte) (Log, error) {
+	log, length, err := DecodeLogHeader(data)
+	if err != nil {
+		return Log{}, err
+	}
+
+	if len(data) < LogHeaderByteLen+length {
+		return Log{}, fmt.Errorf("%w. payload size %d, want %d", ErrInvalidLog, len(data)-LogHeaderByteLen, length)
+	}
+
+	log.PayLoad = data[LogHeaderByteLen : LogHeaderByteLen+length]
+	return log, nil
+}
+
+// DecodeLegacyLog decodes log written on headerless segment, which only has payload
+func DecodeLegacyLog(data []byte) (Log, error) {
 	payload := data
 	return Log{
 		PayLoad: payload,
+		CRC:     crc.Encode(payload),
 	}, nil
 }
@@ -2,7 +2,11 @@
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"testing"
+
+	"github.com/ISSuh/wal/internal/crc"
 )
 
 func TestNewLog(t *testing.T) {
@@ -27,10 +31,21 @@ func TestEncodeLog(t *testing.T) {
 	log := Log{
 		Index:    1,
 		Sequence: 10,
+		Flags:    FlagFirstFragment | FlagLastFragment,
+		Codec:    2,
 		PayLoad:  []byte("test payload"),
 	}
 
-	expected := []byte("test payload")
+	expected := []byte{
+		0x57, 0x41, 0x4c, 0x4c, // Magic
+		3, 2, 0, 0, // Flags, Codec, Reserved
+		0, 0, 0, 0, 0, 0, 0, 1, // Index
+		0, 0, 0, 10, // Sequence
+		0, 0, 0, 12, // Length
+		0, 0, 0, 0, // CRC
+	}
+	binary.BigEndian.PutUint32(expected[24:28], crc.Encode(log.PayLoad))
+	expected = append(expected, log.PayLoad...)
 
 	result := EncodeLog(log)
 	if !bytes.Equal(result, expected) {
@@ -40,16 +55,58 @@ func TestEncodeLog(t *testing.T) {
 
 func TestDecodeLog(t *testing.T) {
 	data := []byte("test payload")
-
 	expected := Log{
-		PayLoad: data,
+		Index:    1,
+		Sequence: 10,
+		Flags:    FlagLastFragment,
+		Codec:    1,
+		CRC:      crc.Encode(data),
+		PayLoad:  data,
 	}
 
-	result, err := DecodeLog(data)
+	result, err := DecodeLog(EncodeLog(expected))
 	if err != nil {
 		t.Fatalf("DecodeLog() error = %v", err)
 	}
+	if result.Index != expected.Index || result.Sequence != expected.Sequence || result.CRC != expected.CRC || result.Codec != expected.Codec {
+		t.Errorf("DecodeLog() = %v, want %v", result, expected)
+	}
+	if result.IsFirstFragment() || !result.IsLastFragment() {
+		t.Errorf("DecodeLog().Flags = %v, want %v", result.Flags, expected.Flags)
+	}
 	if !bytes.Equal(result.PayLoad, expected.PayLoad) {
 		t.Errorf("DecodeLog() = %v, want %v", result.PayLoad, expected.PayLoad)
 	}
 }
+
+func TestDecodeLog_Invalid(t *testing.T) {
+	encoded := EncodeLog(NewLog(1, 0, []byte("test payload")))
+
+	if _, err := DecodeLog(encoded[:LogHeaderByteLen-1]); !errors.Is(err, ErrInvalidLog) {
+		t.Errorf("DecodeLog() error = %v, want %v", err, ErrInvalidLog)
+	}
+
+	if _, err := DecodeLog(encoded[:len(encoded)-1]); !errors.Is(err, ErrInvalidLog) {
+		t.Errorf("DecodeLog() error = %v, want %v", err, ErrInvalidLog)
+	}
+
+	if _, err := DecodeLog([]byte("test payload test payload test payload")); !errors.Is(err, ErrInvalidLog) {
+		t.Errorf("DecodeLog() error = %v, want %v", err, ErrInvalidLog)
+	}
+}
+
+func TestDecodeLegacyLog(t *testing.T) {
+	data := []byte("test payload")
+
+	expected := Log{
+		PayLoad: data,
+	}
+
+	result, err := DecodeLegacyLog(data)
+	if err != nil {
+		t.Fatalf("DecodeLegacyLog() error = %v", err)
+	}
+	if !bytes.Equal(result.PayLoad, expected.PayLoad) {
+		t.Errorf("DecodeLegacyLog() = %v, want %v", result.PayLoad, expected.PayLoad)
+	}
+}
@@ -25,12 +25,16 @@ SOFTWARE.
 package entry
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 )
 
 const (
 	MetadataByteLen = 24
+
+	// HashByteLen is size of chaining hash of log
+	HashByteLen = sha256.Size
 )
 
 type LogMetadata struct {
@@ -51,6 +55,26 @@ func EncodeLogMetadata(m LogMetadata) []byte {
 	return buf
 }
 
+// ChainHash returns SHA-256 hash over hash of the previous log, index and stored payload of log.
+// payload is given as fragments of log. prev is nil for log which does not follow chained log.
+func ChainHash(prev []byte, index int64, fragments ...[]byte) []byte {
+	if prev == nil {
+		prev = make([]byte, HashByteLen)
+	}
+
+	h := sha256.New()
+	h.Write(prev)
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(index))
+	h.Write(buf)
+
+	for _, fragment := range fragments {
+		h.Write(fragment)
+	}
+	return h.Sum(nil)
+}
+
 func DecodeLogMetadata(buf []byte) (LogMetadata, error) {
 	if len(buf) != MetadataByteLen {
 		return LogMetadata{}, fmt.Errorf("invalid segment metadata size. %d", len(buf))
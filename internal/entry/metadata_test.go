@@ -53,3 +53,21 @@ func TestDecodeLogMetadata(t *testing.T) {
 		t.Errorf("DecodeLogMetadata() = %v, want %v", result, expected)
 	}
 }
+
+func TestChainHash(t *testing.T) {
+	first := ChainHash(nil, 0, []byte("test"))
+	if len(first) != HashByteLen {
+		t.Fatalf("ChainHash() size = %d, want %d", len(first), HashByteLen)
+	}
+
+	if !bytes.Equal(first, ChainHash(make([]byte, HashByteLen), 0, []byte("te"), []byte("st"))) {
+		t.Errorf("ChainHash() of fragments differs from hash of payload")
+	}
+
+	if bytes.Equal(ChainHash(first, 1, []byte("test")), ChainHash(first, 2, []byte("test"))) {
+		t.Errorf("ChainHash() of different index is same")
+	}
+	if bytes.Equal(ChainHash(first, 1, []byte("test")), ChainHash(nil, 1, []byte("test"))) {
+		t.Errorf("ChainHash() of different previous hash is same")
+	}
+}
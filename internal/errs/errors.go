@@ -0,0 +1,113 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when log of index has not been written
+	ErrNotFound = errors.New("log not found")
+
+	// ErrClosed is returned when storage is closed
+	ErrClosed = errors.New("storage is closed")
+
+	// ErrCorrupted is returned when stored log or record does not match with its crc or can not be decoded
+	ErrCorrupted = errors.New("log is corrupted")
+
+	// ErrCompacted is returned when log was removed by truncating front
+	ErrCompacted = errors.New("log is compacted")
+
+	// ErrEntryTooLarge is returned when size of log exceeds the limit
+	ErrEntryTooLarge = errors.New("entry is too large")
+
+	// ErrReadOnly is returned when storage or file opened as read only is changed
+	ErrReadOnly = errors.New("read only")
+
+	// ErrLocked is returned when storage is locked by another writer
+	ErrLocked = errors.New("storage is locked by another writer")
+
+	// ErrEmptyBatch is returned when batch to write has no log
+	ErrEmptyBatch = errors.New("batch is empty")
+
+	// ErrTruncated is returned when log was removed by truncating back
+	ErrTruncated = errors.New("log is truncated")
+)
+
+// Error describes operation and location of error.
+// Index, SegmentID and Offset are -1 if error is not of a log or segment.
+type Error struct {
+	Op        string
+	Index     int64
+	SegmentID int
+	Offset    int64
+	Path      string
+	Err       error
+}
+
+// New returns error of op on file of path
+func New(op, path string, err error) *Error {
+	return &Error{Op: op, Index: -1, SegmentID: -1, Offset: -1, Path: path, Err: err}
+}
+
+// WithIndex sets index of log to e and returns e
+func (e *Error) WithIndex(i int64) *Error {
+	e.Index = i
+	return e
+}
+
+// WithSegment sets id of segment and offset of log on it to e and returns e
+func (e *Error) WithSegment(id int, offset int64) *Error {
+	e.SegmentID, e.Offset = id, offset
+	return e
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	if e.Index >= 0 {
+		fmt.Fprintf(&b, " index %d", e.Index)
+	}
+	if e.SegmentID >= 0 {
+		fmt.Fprintf(&b, " segment %d", e.SegmentID)
+	}
+	if e.Offset >= 0 {
+		fmt.Fprintf(&b, " offset %d", e.Offset)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, " %s", e.Path)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,54 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package errs
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	err := New("read", "/tmp/segment_2", ErrCorrupted).WithIndex(10).WithSegment(2, 128)
+
+	expected := "read index 10 segment 2 offset 128 /tmp/segment_2: log is corrupted"
+	if err.Error() != expected {
+		t.Errorf("Error() = %s, want %s", err.Error(), expected)
+	}
+
+	if !errors.Is(err, ErrCorrupted) {
+		t.Errorf("errors.Is() = false, want true")
+	}
+
+	var target *Error
+	if !errors.As(error(err), &target) || target.Index != 10 {
+		t.Errorf("errors.As() = %+v, want index 10", target)
+	}
+
+	err = New("open", "", io.EOF)
+	if err.Error() != "open: EOF" {
+		t.Errorf("Error() = %s, want open: EOF", err.Error())
+	}
+}
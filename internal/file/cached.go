@@ -0,0 +1,127 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package file
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ISSuh/wal/internal/errs"
+)
+
+// cachedFile is file of which whole content is kept on memory.
+// content is loaded when opened, and updated after written to the file, so reading it needs no syscall.
+type cachedFile struct {
+	*file
+	data []byte
+}
+
+// NewCachedFile returns file to append of which content is cached on memory
+func NewCachedFile() File {
+	return &cachedFile{
+		file: NewFile().(*file),
+	}
+}
+
+func (f *cachedFile) Open(filePath string) error {
+	if err := f.file.Open(filePath); err != nil {
+		return err
+	}
+
+	if err := f.load(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("failed to load file. %w", err)
+	}
+	return nil
+}
+
+func (f *cachedFile) Close() error {
+	f.data = nil
+	return f.file.Close()
+}
+
+func (f *cachedFile) Write(data []byte) error {
+	if err := f.file.Write(data); err != nil {
+		// part of data may be written. reload content to keep it same with the file
+		if loadErr := f.load(); loadErr != nil {
+			return fmt.Errorf("%w. failed to reload file. %v", err, loadErr)
+		}
+		return err
+	}
+
+	f.data = append(f.data, data...)
+	return nil
+}
+
+func (f *cachedFile) ReadAt(offset int64, size int) ([]byte, error) {
+	if offset < 0 || size < 0 {
+		return nil, errs.New("read", f.filePath, fmt.Errorf("invalid range. offset %d, size %d", offset, size))
+	}
+
+	if offset+int64(size) > int64(len(f.data)) {
+		return nil, errs.New("read", f.filePath, io.EOF)
+	}
+
+	buf := make([]byte, size)
+	copy(buf, f.data[offset:])
+	return buf, nil
+}
+
+func (f *cachedFile) Size() (int64, error) {
+	return int64(len(f.data)), nil
+}
+
+func (f *cachedFile) Truncate(size int64) error {
+	if err := f.file.Truncate(size); err != nil {
+		return err
+	}
+
+	if size <= int64(len(f.data)) {
+		f.data = f.data[:size]
+		return nil
+	}
+
+	// file is extended with zeros
+	f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	return nil
+}
+
+// load reads whole content of the file
+func (f *cachedFile) load() error {
+	size, err := f.file.Size()
+	if err != nil {
+		return err
+	}
+
+	f.data = make([]byte, size)
+	if size == 0 {
+		return nil
+	}
+
+	if _, err := f.file.f.ReadAt(f.data, 0); err != nil {
+		return pathError("read", f.filePath, err)
+	}
+	return nil
+}
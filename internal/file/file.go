@@ -25,8 +25,12 @@ SOFTWARE.
 package file
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+
+	"github.com/ISSuh/wal/internal/errs"
 )
 
 type File interface {
@@ -42,17 +46,27 @@ type File interface {
 
 type file struct {
 	filePath string
+	flag     int
 	f        *os.File
 }
 
 func NewFile() File {
-	return &file{}
+	return &file{
+		flag: os.O_RDWR | os.O_CREATE | os.O_APPEND,
+	}
+}
+
+// NewReadOnlyFile returns file which can only be read. file must exist to be opened.
+func NewReadOnlyFile() File {
+	return &file{
+		flag: os.O_RDONLY,
+	}
 }
 
 func (f *file) Open(filePath string) error {
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	file, err := os.OpenFile(filePath, f.flag, 0644)
 	if err != nil {
-		return err
+		return pathError("open", filePath, err)
 	}
 
 	f.filePath = filePath
@@ -63,7 +77,7 @@ func (f *file) Open(filePath string) error {
 func (f *file) Close() error {
 	err := f.f.Close()
 	if err != nil {
-		return err
+		return pathError("close", f.filePath, err)
 	}
 	return nil
 }
@@ -71,11 +85,11 @@ func (f *file) Close() error {
 func (f *file) Write(data []byte) error {
 	n, err := f.f.Write(data)
 	if err != nil {
-		return err
+		return pathError("write", f.filePath, err)
 	}
 
 	if n != len(data) {
-		return fmt.Errorf("failed to write all data. %d != %d", n, len(data))
+		return pathError("write", f.filePath, fmt.Errorf("failed to write all data. %d != %d", n, len(data)))
 	}
 
 	return nil
@@ -85,7 +99,7 @@ func (f *file) ReadAt(offset int64, size int) ([]byte, error) {
 	buf := make([]byte, size)
 	_, err := f.f.ReadAt(buf, offset)
 	if err != nil {
-		return nil, err
+		return nil, pathError("read", f.filePath, err)
 	}
 	return buf, nil
 }
@@ -93,7 +107,7 @@ func (f *file) ReadAt(offset int64, size int) ([]byte, error) {
 func (f *file) Sync() error {
 	err := f.f.Sync()
 	if err != nil {
-		return err
+		return pathError("sync", f.filePath, err)
 	}
 	return nil
 }
@@ -101,7 +115,7 @@ func (f *file) Sync() error {
 func (f *file) Size() (int64, error) {
 	stat, err := f.f.Stat()
 	if err != nil {
-		return 0, err
+		return 0, pathError("stat", f.filePath, err)
 	}
 	return stat.Size(), nil
 }
@@ -109,7 +123,7 @@ func (f *file) Size() (int64, error) {
 func (f *file) Truncate(size int64) error {
 	err := f.f.Truncate(size)
 	if err != nil {
-		return err
+		return pathError("truncate", f.filePath, err)
 	}
 	return nil
 }
@@ -117,3 +131,65 @@ func (f *file) Truncate(size int64) error {
 func (f *file) Path() string {
 	return f.filePath
 }
+
+// pathError converts error of operation on file to errs.Error.
+// path of os.PathError is moved to the error, so it is not repeated in message.
+func pathError(op, filePath string, err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return errs.New(op, filePath, err)
+}
+
+// Rewrite replaces content of file on filePath with data atomically.
+// data is written on temporary file and replaces file after synced.
+func Rewrite(filePath string, data []byte) error {
+	tempPath := filePath + ".tmp"
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return Replace(tempPath, filePath)
+}
+
+// Replace renames file on srcPath to dstPath and syncs directory to persist the rename
+func Replace(srcPath, dstPath string) error {
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(dstPath))
+}
+
+// Remove removes file on filePath and syncs directory to persist the removal
+func Remove(filePath string) error {
+	if err := os.Remove(filePath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filePath))
+}
+
+func syncDir(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -25,8 +25,12 @@ SOFTWARE.
 package file
 
 import (
+	"errors"
+	"io"
 	"os"
 	"testing"
+
+	"github.com/ISSuh/wal/internal/errs"
 )
 
 func TestFile_Open(t *testing.T) {
@@ -153,3 +157,216 @@ func TestFile_Truncate(t *testing.T) {
 		t.Errorf("expected size 5, got %d", size)
 	}
 }
+
+func TestFile_ReadOnly(t *testing.T) {
+	f := NewReadOnlyFile()
+	if err := f.Open("testfile.txt"); err == nil {
+		t.Fatalf("expected error on opening file which does not exist")
+	}
+
+	if err := os.WriteFile("testfile.txt", []byte("hello world"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Remove("testfile.txt")
+
+	if err := f.Open("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Write([]byte("hello")); err == nil {
+		t.Errorf("expected error on writing read only file")
+	}
+
+	readData, err := f.ReadAt(6, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "world" {
+		t.Errorf("expected world, got %s", string(readData))
+	}
+}
+
+func TestMmapFile(t *testing.T) {
+	if err := os.WriteFile("testfile.txt", []byte("hello world"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Remove("testfile.txt")
+
+	f := NewMmapFile()
+	if err := f.Open("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Write([]byte("hello")); err == nil {
+		t.Errorf("expected error on writing mapped file")
+	}
+
+	size, err := f.Size()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if size != 11 {
+		t.Errorf("expected size to be 11, got %d", size)
+	}
+
+	readData, err := f.ReadAt(6, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "world" {
+		t.Errorf("expected world, got %s", string(readData))
+	}
+
+	view, err := f.(Viewer).View(0, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(view) != "hello" {
+		t.Errorf("expected hello, got %s", string(view))
+	}
+
+	if _, err := f.ReadAt(6, 6); err == nil {
+		t.Errorf("expected error on reading out of mapped range")
+	}
+}
+
+func TestMmapFile_Empty(t *testing.T) {
+	if err := os.WriteFile("testfile.txt", []byte{}, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Remove("testfile.txt")
+
+	f := NewMmapFile()
+	if err := f.Open("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := f.ReadAt(0, 1); err == nil {
+		t.Errorf("expected error on reading empty file")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCachedFile(t *testing.T) {
+	f := NewCachedFile()
+	if err := f.Open("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Remove("testfile.txt")
+	defer f.Close()
+
+	if err := f.Write([]byte("hello world")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	readData, err := f.ReadAt(6, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "world" {
+		t.Errorf("expected world, got %s", string(readData))
+	}
+
+	if err := f.Truncate(5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := f.ReadAt(4, 2); err == nil {
+		t.Errorf("expected error on reading truncated data")
+	}
+
+	size, err := f.Size()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if size != 5 {
+		t.Errorf("expected size to be 5, got %d", size)
+	}
+
+	// cached content is same with the file
+	readData, err = os.ReadFile("testfile.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "hello" {
+		t.Errorf("expected hello, got %s", string(readData))
+	}
+
+	reopened := NewCachedFile()
+	if err := reopened.Open("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer reopened.Close()
+
+	readData, err = reopened.ReadAt(0, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "hello" {
+		t.Errorf("expected hello, got %s", string(readData))
+	}
+}
+
+func TestReplace(t *testing.T) {
+	if err := os.WriteFile("testfile.tmp", []byte("new"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.WriteFile("testfile.txt", []byte("old"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Remove("testfile.txt")
+
+	if err := Replace("testfile.tmp", "testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	readData, err := os.ReadFile("testfile.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "new" {
+		t.Errorf("expected new, got %s", string(readData))
+	}
+}
+
+func TestRemove(t *testing.T) {
+	if err := os.WriteFile("testfile.txt", []byte("data"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := Remove("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := os.Stat("testfile.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected file to be removed, got %v", err)
+	}
+}
+
+func TestFile_Error(t *testing.T) {
+	f := NewReadOnlyFile()
+	err := f.Open("notexist.txt")
+
+	var fileErr *errs.Error
+	if !errors.As(err, &fileErr) || fileErr.Op != "open" || fileErr.Path != "notexist.txt" {
+		t.Fatalf("expected open error of notexist.txt, got %v", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+
+	f = NewFile()
+	if err := f.Open("testfile.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Remove("testfile.txt")
+	defer f.Close()
+
+	if _, err := f.ReadAt(0, 10); !errors.Is(err, io.EOF) || !errors.As(err, &fileErr) || fileErr.Op != "read" {
+		t.Errorf("expected read error of EOF, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package file
+
+import (
+	"os"
+	"sync"
+
+	"github.com/ISSuh/wal/internal/errs"
+)
+
+// locked is files locked by this process. flock(2) is not available on every platform,
+// so files are at least protected from another open in this process.
+// files are compared by identity like flock(2), so file created again on the same path is not locked.
+var (
+	lockedMutex sync.Mutex
+	locked      = make(map[*os.File]os.FileInfo)
+)
+
+// Lock is advisory lock on file, held until it is unlocked or process exits
+type Lock struct {
+	f *os.File
+}
+
+// TryLock locks file of filePath exclusively without blocking. file is created if not exists.
+// returns errs.ErrLocked if the file is locked by another open of this process, or by another process
+// on platform supporting flock(2).
+func TryLock(filePath string) (*Lock, error) {
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, pathError("open", filePath, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, pathError("stat", filePath, err)
+	}
+
+	lockedMutex.Lock()
+	defer lockedMutex.Unlock()
+
+	for _, other := range locked {
+		if os.SameFile(info, other) {
+			f.Close()
+			return nil, errs.New("lock", filePath, errs.ErrLocked)
+		}
+	}
+
+	if err := flock(f); err != nil {
+		f.Close()
+		return nil, errs.New("lock", filePath, err)
+	}
+
+	locked[f] = info
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock. file is left on the path to be locked again.
+func (l *Lock) Unlock() error {
+	lockedMutex.Lock()
+	delete(locked, l.f)
+	lockedMutex.Unlock()
+
+	if err := funlock(l.f); err != nil {
+		l.f.Close()
+		return pathError("unlock", l.f.Name(), err)
+	}
+
+	if err := l.f.Close(); err != nil {
+		return pathError("close", l.f.Name(), err)
+	}
+	return nil
+}
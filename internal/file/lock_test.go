@@ -0,0 +1,57 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package file
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ISSuh/wal/internal/errs"
+)
+
+func TestTryLock(t *testing.T) {
+	defer os.Remove("testlock")
+
+	lock, err := TryLock("testlock")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// lock is not acquired again in the same process
+	if _, err := TryLock("testlock"); !errors.Is(err, errs.ErrLocked) {
+		t.Fatalf("expected %v, got %v", errs.ErrLocked, err)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	lock, err = TryLock("testlock")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	lock.Unlock()
+}
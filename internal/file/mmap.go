@@ -0,0 +1,120 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ISSuh/wal/internal/errs"
+)
+
+// ErrReadOnly is returned when mapped file is written
+var ErrReadOnly = errs.ErrReadOnly
+
+// Viewer is implemented by file which can expose its content without copying
+type Viewer interface {
+	// View returns slice of content at offset. slice is valid until file is closed and must not be modified.
+	View(offset int64, size int) ([]byte, error)
+}
+
+// mmapFile is read only file mapped on memory. reading it is a copy from the mapping without syscall.
+// file must not be truncated or written while mapped.
+type mmapFile struct {
+	filePath string
+	data     []byte
+}
+
+// NewMmapFile returns read only file of which content is mapped on memory when opened
+func NewMmapFile() File {
+	return &mmapFile{}
+}
+
+func (f *mmapFile) Open(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return pathError("open", filePath, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return pathError("stat", filePath, err)
+	}
+
+	data, err := mmap(file, int(stat.Size()))
+	if err != nil {
+		return pathError("mmap", filePath, err)
+	}
+
+	f.filePath = filePath
+	f.data = data
+	return nil
+}
+
+func (f *mmapFile) Close() error {
+	data := f.data
+	f.data = nil
+	return munmap(data)
+}
+
+func (f *mmapFile) Write([]byte) error {
+	return errs.New("write", f.filePath, ErrReadOnly)
+}
+
+func (f *mmapFile) ReadAt(offset int64, size int) ([]byte, error) {
+	data, err := f.View(offset, size)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	copy(buf, data)
+	return buf, nil
+}
+
+func (f *mmapFile) View(offset int64, size int) ([]byte, error) {
+	if offset < 0 || size < 0 || offset+int64(size) > int64(len(f.data)) {
+		return nil, errs.New("read", f.filePath, fmt.Errorf("out of mapped range. offset %d, size %d, mapped %d. %w", offset, size, len(f.data), io.EOF))
+	}
+	return f.data[offset : offset+int64(size) : offset+int64(size)], nil
+}
+
+func (f *mmapFile) Sync() error {
+	return nil
+}
+
+func (f *mmapFile) Size() (int64, error) {
+	return int64(len(f.data)), nil
+}
+
+func (f *mmapFile) Truncate(int64) error {
+	return errs.New("truncate", f.filePath, ErrReadOnly)
+}
+
+func (f *mmapFile) Path() string {
+	return f.filePath
+}
@@ -25,8 +25,10 @@ SOFTWARE.
 package index
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/ISSuh/wal/internal/errs"
 	"github.com/ISSuh/wal/internal/file"
 )
 
@@ -36,18 +38,46 @@ const (
 
 type File struct {
 	file.File
-	basePath       string
-	syncAfterWrite bool
+	basePath string
+	readOnly bool
+
+	// headerSize is 0 on index file written by previous version
+	headerSize int
+	firstIndex int64
 
 	lastIndex Index
 	size      int
 }
 
-func NewFile(basePath string, syncAfterWrite bool) *File {
+// NewFile returns index file to append. written indexes are durable after Sync.
+func NewFile(basePath string) *File {
+	return &File{
+		File:     file.NewFile(),
+		basePath: basePath,
+		lastIndex: Index{
+			Index: -1,
+		},
+	}
+}
+
+// NewCachedFile returns index file to append of which records are cached on memory.
+// indexes are read without syscall.
+func NewCachedFile(basePath string) *File {
+	return &File{
+		File:     file.NewCachedFile(),
+		basePath: basePath,
+		lastIndex: Index{
+			Index: -1,
+		},
+	}
+}
+
+// NewReadOnlyFile returns index file which can only be read
+func NewReadOnlyFile(basePath string) *File {
 	return &File{
-		File:           file.NewFile(),
-		basePath:       basePath,
-		syncAfterWrite: syncAfterWrite,
+		File:     file.NewReadOnlyFile(),
+		basePath: basePath,
+		readOnly: true,
 		lastIndex: Index{
 			Index: -1,
 		},
@@ -59,6 +89,14 @@ func (f *File) Open() error {
 	if err := f.File.Open(filePath); err != nil {
 		return fmt.Errorf("failed to open index file. %w", err)
 	}
+
+	if err := f.readHeader(); err != nil {
+		return fmt.Errorf("failed to read header of index file. %w", err)
+	}
+
+	if err := f.recover(); err != nil {
+		return fmt.Errorf("failed to recover index file. %w", err)
+	}
 	return nil
 }
 
@@ -72,50 +110,259 @@ func (f *File) Close() error {
 }
 
 func (f *File) Write(i Index) error {
-	buf := EncodeIndex(i)
-	if err := f.File.Write(buf); err != nil {
-		return fmt.Errorf("failed to write index. %w", err)
+	return f.WriteBatch([]Index{i})
+}
+
+// WriteBatch writes indexes with a single write
+func (f *File) WriteBatch(indexes []Index) error {
+	if len(indexes) == 0 {
+		return nil
 	}
 
-	if f.syncAfterWrite {
-		if err := f.File.Sync(); err != nil {
-			return fmt.Errorf("failed to sync index file. %w", err)
-		}
+	buf := make([]byte, 0, len(indexes)*indexSize)
+	for _, i := range indexes {
+		buf = append(buf, EncodeIndex(i)...)
 	}
 
-	f.lastIndex = i
-	f.size = len(buf)
+	if err := f.File.Write(buf); err != nil {
+		return fmt.Errorf("failed to write index. %w", err)
+	}
+
+	f.lastIndex = indexes[len(indexes)-1]
+	f.size += len(buf)
 	return nil
 }
 
 func (f *File) Read(i int64) (Index, error) {
-	offset := i * indexSize
-	buf, err := f.File.ReadAt(offset, indexSize)
+	if err := f.checkRange(i, 1); err != nil {
+		return Index{}, err
+	}
+
+	buf, err := f.File.ReadAt(f.offset(i), indexSize)
 	if err != nil {
 		return Index{}, fmt.Errorf("failed to read index. %w", err)
 	}
 
 	index, err := DecodeIndex(buf)
 	if err != nil {
-		return index, fmt.Errorf("failed to decode index. %w", err)
+		return index, errs.New("decode", f.File.Path(), fmt.Errorf("%w. %v", errs.ErrCorrupted, err)).WithIndex(i)
 	}
 
 	return index, nil
 }
 
+// ReadRange reads count indexes from index i with a single read
+func (f *File) ReadRange(i int64, count int) ([]Index, error) {
+	if err := f.checkRange(i, count); err != nil {
+		return nil, err
+	}
+
+	buf, err := f.File.ReadAt(f.offset(i), count*indexSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index. %w", err)
+	}
+
+	indexes := make([]Index, 0, count)
+	for begin := 0; begin < len(buf); begin += indexSize {
+		index, err := DecodeIndex(buf[begin : begin+indexSize])
+		if err != nil {
+			return nil, errs.New("decode", f.File.Path(), fmt.Errorf("%w. %v", errs.ErrCorrupted, err)).WithIndex(i + int64(begin/indexSize))
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
+}
+
+// FirstIndex returns index of the first log on the file.
+// indexes before it were removed by TruncateFront.
+func (f *File) FirstIndex() int64 {
+	return f.firstIndex
+}
+
+// LastIndex returns index of the last log on the file. returns FirstIndex - 1 if file is empty
 func (f *File) LastIndex() int64 {
 	return f.lastIndex.Index
 }
 
-func (f *File) Rollback() error {
-	if f.size < indexSize {
+// TruncateFront removes all indexes before i from the file.
+// file is rewritten with header of new first index and replaced atomically.
+func (f *File) TruncateFront(i int64) error {
+	if f.readOnly {
+		return errs.New("truncate", f.File.Path(), errs.ErrReadOnly)
+	}
+
+	if i <= f.firstIndex {
 		return nil
 	}
 
-	targetSize := int64(f.size - indexSize)
+	if i > f.lastIndex.Index+1 {
+		return errs.New("truncate", f.File.Path(), errs.ErrNotFound).WithIndex(i)
+	}
+
+	buf := EncodeHeader(i)
+	if i <= f.lastIndex.Index {
+		remained, err := f.File.ReadAt(f.offset(i), f.size-int(f.offset(i)))
+		if err != nil {
+			return fmt.Errorf("failed to read index. %w", err)
+		}
+		buf = append(buf, remained...)
+	}
+
+	filePath := f.File.Path()
+	if err := file.Rewrite(filePath, buf); err != nil {
+		return fmt.Errorf("failed to rewrite index file. %w", err)
+	}
+
+	// reopen replaced file
+	if err := f.File.Close(); err != nil {
+		return fmt.Errorf("failed to close index file. %w", err)
+	}
+
+	return f.Open()
+}
+
+// Reset moves first index of the file which has no index to i, so the next index is written at i.
+func (f *File) Reset(i int64) error {
+	if f.readOnly {
+		return errs.New("reset", f.File.Path(), errs.ErrReadOnly)
+	}
+
+	if f.firstIndex <= f.lastIndex.Index {
+		return errors.New("index file is not empty")
+	}
+
+	if err := file.Rewrite(f.File.Path(), EncodeHeader(i)); err != nil {
+		return fmt.Errorf("failed to rewrite index file. %w", err)
+	}
+
+	// reopen replaced file
+	if err := f.File.Close(); err != nil {
+		return fmt.Errorf("failed to close index file. %w", err)
+	}
+
+	return f.Open()
+}
+
+// TruncateBack removes all indexes after i from the file.
+// partial record left on the tail of file is removed too.
+func (f *File) TruncateBack(i int64) error {
+	targetSize := f.offset(i + 1)
+	if targetSize < int64(f.headerSize) {
+		targetSize = int64(f.headerSize)
+	}
+
 	if err := f.File.Truncate(targetSize); err != nil {
 		return fmt.Errorf("failed to truncate index file. %w", err)
 	}
 
+	return f.recover()
+}
+
+// checkRange returns error if any of count indexes from index i is removed or not written yet
+func (f *File) checkRange(i int64, count int) error {
+	// negative index is never written, even if logs before the first index were removed
+	if i < 0 {
+		return errs.New("read", f.File.Path(), errs.ErrNotFound).WithIndex(i)
+	}
+
+	if i < f.firstIndex {
+		return errs.New("read", f.File.Path(), ErrCompacted).WithIndex(i)
+	}
+
+	if last := i + int64(count) - 1; last > f.lastIndex.Index {
+		return errs.New("read", f.File.Path(), errs.ErrNotFound).WithIndex(last)
+	}
+	return nil
+}
+
+// offset returns offset of index i on the file
+func (f *File) offset(i int64) int64 {
+	return int64(f.headerSize) + (i-f.firstIndex)*indexSize
+}
+
+// readHeader reads header of the file. header is written on new file.
+func (f *File) readHeader() error {
+	size, err := f.File.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get file size. %w", err)
+	}
+
+	f.headerSize, f.firstIndex = 0, 0
+	if size == 0 {
+		if f.readOnly {
+			return nil
+		}
+		return f.writeHeader()
+	}
+
+	headerBytes := int64(headerSize)
+	if size < headerBytes {
+		headerBytes = size
+	}
+
+	buf, err := f.File.ReadAt(0, int(headerBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read header. %w", err)
+	}
+
+	header, err := DecodeHeader(buf)
+	switch {
+	case errors.Is(err, ErrNoHeader):
+		// index file written by previous version
+		return nil
+	case err != nil && size < headerSize && !f.readOnly:
+		// header was torn while creating file
+		if err := f.File.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate torn header. %w", err)
+		}
+		return f.writeHeader()
+	case err != nil:
+		return err
+	}
+
+	f.headerSize = headerSize
+	f.firstIndex = header.FirstIndex
+	return nil
+}
+
+func (f *File) writeHeader() error {
+	if err := f.File.Write(EncodeHeader(0)); err != nil {
+		return fmt.Errorf("failed to write header. %w", err)
+	}
+
+	f.headerSize = headerSize
+	return nil
+}
+
+// recover loads last index from the records already written on the file
+func (f *File) recover() error {
+	size, err := f.File.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get file size. %w", err)
+	}
+
+	records := (size - int64(f.headerSize)) / indexSize
+	if records < 0 {
+		records = 0
+	}
+
+	f.size = f.headerSize + int(records)*indexSize
+	f.lastIndex = Index{Index: f.firstIndex - 1}
+	if records == 0 {
+		return nil
+	}
+
+	buf, err := f.File.ReadAt(int64(f.size-indexSize), indexSize)
+	if err != nil {
+		return fmt.Errorf("failed to read last index. %w", err)
+	}
+
+	lastIndex, err := DecodeIndex(buf)
+	if err != nil {
+		return fmt.Errorf("failed to decode last index. %w", err)
+	}
+
+	f.lastIndex = lastIndex
 	return nil
 }
@@ -1,8 +1,11 @@
 ﻿package index
 
 import (
+	"errors"
 	"os"
 	"testing"
+
+	"github.com/ISSuh/wal/internal/errs"
 )
 
 func setup() (*File, func()) {
@@ -11,7 +14,7 @@ func setup() (*File, func()) {
 		panic(err)
 	}
 
-	f := NewFile(basePath, true)
+	f := NewFile(basePath)
 	return f, func() {
 		os.RemoveAll(basePath)
 	}
@@ -19,7 +22,7 @@ func setup() (*File, func()) {
 
 func TestNewFile(t *testing.T) {
 	basePath := "./testdata"
-	f := NewFile(basePath, true)
+	f := NewFile(basePath)
 	if f == nil {
 		t.Errorf("NewFile() returned nil")
 	}
@@ -90,6 +93,10 @@ func TestFile_Read(t *testing.T) {
 	if readIndex != index {
 		t.Errorf("File.Read() = %v, want %v", readIndex, index)
 	}
+
+	if _, err := f.Read(-1); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("File.Read(-1) error = %v, want %v", err, errs.ErrNotFound)
+	}
 }
 
 func TestFile_LastIndex(t *testing.T) {
@@ -110,3 +117,202 @@ func TestFile_LastIndex(t *testing.T) {
 		t.Errorf("File.LastIndex() = %v, want %v", f.LastIndex(), 0)
 	}
 }
+
+func TestFile_Reopen(t *testing.T) {
+	f, teardown := setup()
+	defer teardown()
+
+	if err := f.Open(); err != nil {
+		t.Errorf("File.Open() error = %v", err)
+	}
+
+	for i := int64(0); i < 3; i++ {
+		if err := f.Write(NewIndex(i, i*10, 10)); err != nil {
+			t.Errorf("File.Write() error = %v", err)
+		}
+	}
+	f.Close()
+
+	reopened := NewFile(f.basePath)
+	if err := reopened.Open(); err != nil {
+		t.Errorf("File.Open() error = %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.LastIndex() != 2 {
+		t.Errorf("File.LastIndex() = %v, want %v", reopened.LastIndex(), 2)
+	}
+}
+
+func TestFile_TruncateFront(t *testing.T) {
+	f, teardown := setup()
+	defer teardown()
+
+	if err := f.Open(); err != nil {
+		t.Fatalf("File.Open() error = %v", err)
+	}
+	defer f.Close()
+
+	for i := int64(0); i < 5; i++ {
+		if err := f.Write(NewIndex(i, i*10, 10)); err != nil {
+			t.Fatalf("File.Write() error = %v", err)
+		}
+	}
+
+	if err := f.TruncateFront(3); err != nil {
+		t.Fatalf("File.TruncateFront() error = %v", err)
+	}
+
+	if _, err := f.Read(2); !errors.Is(err, ErrCompacted) {
+		t.Errorf("File.Read() error = %v, want %v", err, ErrCompacted)
+	}
+
+	index, err := f.Read(3)
+	if err != nil {
+		t.Fatalf("File.Read() error = %v", err)
+	}
+	if index.Index != 3 || index.MetadataOffset != 30 {
+		t.Errorf("File.Read() = %+v, want index 3", index)
+	}
+
+	if err := f.Write(NewIndex(5, 50, 10)); err != nil {
+		t.Fatalf("File.Write() error = %v", err)
+	}
+
+	reopened := NewFile(f.basePath)
+	if err := reopened.Open(); err != nil {
+		t.Fatalf("File.Open() error = %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.FirstIndex() != 3 || reopened.LastIndex() != 5 {
+		t.Errorf("File range = %d - %d, want 3 - 5", reopened.FirstIndex(), reopened.LastIndex())
+	}
+
+	// every index is removed
+	if err := reopened.TruncateFront(6); err != nil {
+		t.Fatalf("File.TruncateFront() error = %v", err)
+	}
+	if reopened.FirstIndex() != 6 || reopened.LastIndex() != 5 {
+		t.Errorf("File range = %d - %d, want 6 - 5", reopened.FirstIndex(), reopened.LastIndex())
+	}
+
+	if err := reopened.TruncateFront(8); err == nil {
+		t.Errorf("File.TruncateFront() expected error on index out of range")
+	}
+}
+
+func TestFile_Reset(t *testing.T) {
+	f, teardown := setup()
+	defer teardown()
+
+	if err := f.Open(); err != nil {
+		t.Fatalf("File.Open() error = %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Reset(10); err != nil {
+		t.Fatalf("File.Reset() error = %v", err)
+	}
+	if f.FirstIndex() != 10 || f.LastIndex() != 9 {
+		t.Errorf("File range = %d - %d, want 10 - 9", f.FirstIndex(), f.LastIndex())
+	}
+
+	if err := f.Write(NewIndex(10, 0, 10)); err != nil {
+		t.Fatalf("File.Write() error = %v", err)
+	}
+	if index, err := f.Read(10); err != nil || index.Index != 10 {
+		t.Errorf("File.Read() = %+v, %v, want index 10", index, err)
+	}
+
+	if err := f.Reset(20); err == nil {
+		t.Errorf("File.Reset() expected error on file which has index")
+	}
+}
+
+func TestFile_Legacy(t *testing.T) {
+	f, teardown := setup()
+	defer teardown()
+
+	// index file written by previous version has no header
+	buf := make([]byte, 0)
+	for i := int64(0); i < 3; i++ {
+		buf = append(buf, EncodeIndex(NewIndex(i, i*10, 10))...)
+	}
+	if err := os.WriteFile(f.basePath+"/"+IndexFileName, buf, 0644); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	if err := f.Open(); err != nil {
+		t.Fatalf("File.Open() error = %v", err)
+	}
+	defer f.Close()
+
+	if f.FirstIndex() != 0 || f.LastIndex() != 2 {
+		t.Errorf("File range = %d - %d, want 0 - 2", f.FirstIndex(), f.LastIndex())
+	}
+
+	index, err := f.Read(1)
+	if err != nil {
+		t.Fatalf("File.Read() error = %v", err)
+	}
+	if index.MetadataOffset != 10 {
+		t.Errorf("File.Read() = %+v, want offset 10", index)
+	}
+
+	// truncating front writes header
+	if err := f.TruncateFront(1); err != nil {
+		t.Fatalf("File.TruncateFront() error = %v", err)
+	}
+	if index, err := f.Read(2); err != nil || index.Index != 2 {
+		t.Errorf("File.Read() = %+v, %v, want index 2", index, err)
+	}
+}
+
+func TestFile_Cached(t *testing.T) {
+	f, teardown := setup()
+	defer teardown()
+
+	cached := NewCachedFile(f.basePath)
+	if err := cached.Open(); err != nil {
+		t.Fatalf("File.Open() error = %v", err)
+	}
+	defer cached.Close()
+
+	for i := int64(0); i < 5; i++ {
+		if err := cached.Write(NewIndex(i, i*10, 10)); err != nil {
+			t.Fatalf("File.Write() error = %v", err)
+		}
+	}
+
+	if err := cached.TruncateBack(3); err != nil {
+		t.Fatalf("File.TruncateBack() error = %v", err)
+	}
+	if err := cached.TruncateFront(1); err != nil {
+		t.Fatalf("File.TruncateFront() error = %v", err)
+	}
+
+	if _, err := cached.Read(4); err == nil {
+		t.Errorf("File.Read() expected error on truncated index")
+	}
+
+	// cached records are same with the file
+	if err := f.Open(); err != nil {
+		t.Fatalf("File.Open() error = %v", err)
+	}
+	defer f.Close()
+
+	if f.FirstIndex() != cached.FirstIndex() || f.LastIndex() != cached.LastIndex() {
+		t.Errorf("File range = %d - %d, want %d - %d", cached.FirstIndex(), cached.LastIndex(), f.FirstIndex(), f.LastIndex())
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		index, err := cached.Read(i)
+		if err != nil {
+			t.Fatalf("File.Read() error = %v", err)
+		}
+		if index != NewIndex(i, i*10, 10) {
+			t.Errorf("File.Read() = %+v, want index %d", index, i)
+		}
+	}
+}
@@ -25,14 +25,42 @@ SOFTWARE.
 package index
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+
+	"github.com/ISSuh/wal/internal/errs"
+)
+
+var (
+	// ErrNoHeader is returned when index file does not start with header
+	ErrNoHeader = errors.New("index file has no header")
+
+	// ErrCompacted is returned when index was removed by truncating front of index file
+	ErrCompacted = errs.ErrCompacted
 )
 
 const (
 	indexSize = 20
+
+	// HeaderMagic is "WALI", written on the head of index file
+	HeaderMagic = 0x57414c49
+
+	// FormatVersion is the version of index file written by this package
+	FormatVersion = 1
+
+	// headerSize is the same as index to keep records aligned
+	headerSize = indexSize
 )
 
+// Header is written on the head of index file.
+// index file written by previous version has no header, and its first index is 0.
+type Header struct {
+	Version    uint32
+	FirstIndex int64
+}
+
 type Index struct {
 	Index          int64
 	MetadataOffset int64
@@ -55,6 +83,39 @@ func EncodeIndex(i Index) []byte {
 	return buf
 }
 
+// EncodeHeader encodes header of index file.
+// Layout: Magic(4) | Version(4) | FirstIndex(8) | Reserved(4)
+func EncodeHeader(firstIndex int64) []byte {
+	buf := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(buf, HeaderMagic)
+	binary.LittleEndian.PutUint32(buf[4:], FormatVersion)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(firstIndex))
+	return buf
+}
+
+// DecodeHeader decodes header of index file. returns ErrNoHeader if data does not start with magic.
+func DecodeHeader(data []byte) (Header, error) {
+	magic := EncodeHeader(0)[:4]
+	if len(data) < len(magic) && !bytes.HasPrefix(magic, data) ||
+		len(data) >= len(magic) && !bytes.Equal(data[:len(magic)], magic) {
+		return Header{}, ErrNoHeader
+	}
+
+	if len(data) < headerSize {
+		return Header{}, fmt.Errorf("invalid header size. %d", len(data))
+	}
+
+	h := Header{
+		Version:    binary.LittleEndian.Uint32(data[4:8]),
+		FirstIndex: int64(binary.LittleEndian.Uint64(data[8:16])),
+	}
+
+	if h.Version > FormatVersion {
+		return Header{}, fmt.Errorf("unsupported index file version %d", h.Version)
+	}
+	return h, nil
+}
+
 func DecodeIndex(data []byte) (Index, error) {
 	if len(data) != indexSize {
 		return Index{}, fmt.Errorf("invalid index size. %d", len(data))
@@ -25,38 +25,74 @@ SOFTWARE.
 package metadata
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/ISSuh/wal/internal/errs"
 	"github.com/ISSuh/wal/internal/file"
 )
 
 const (
-	metadataFileName = "metadata"
+	MetadataFileName = "metadata"
 )
 
 type File struct {
 	file.File
-	basePath       string
-	syncAfterWrite bool
+	basePath string
+	readOnly bool
 
-	offset       int64
-	lastMetadata Data
+	// offsets of metadata are kept after front of file is truncated.
+	// metadata of offset is at offset - baseOffset + headerSize on the file.
+	headerSize int64
+	baseOffset int64
+
+	offset int64
+}
+
+// NewFile returns metadata file to append. written metadata is durable after Sync.
+func NewFile(basePath string) *File {
+	return &File{
+		File:     file.NewFile(),
+		basePath: basePath,
+	}
 }
 
-func NewFile(basePath string, syncAfterWrite bool) *File {
+// NewCachedFile returns metadata file to append of which records are cached on memory.
+// metadata is read without syscall.
+func NewCachedFile(basePath string) *File {
 	return &File{
-		File:           file.NewFile(),
-		basePath:       basePath,
-		syncAfterWrite: syncAfterWrite,
+		File:     file.NewCachedFile(),
+		basePath: basePath,
+	}
+}
+
+// NewReadOnlyFile returns metadata file which can only be read
+func NewReadOnlyFile(basePath string) *File {
+	return &File{
+		File:     file.NewReadOnlyFile(),
+		basePath: basePath,
+		readOnly: true,
 	}
 }
 
 func (f *File) Open() error {
-	filePath := fmt.Sprintf("%s/%s", f.basePath, metadataFileName)
+	filePath := fmt.Sprintf("%s/%s", f.basePath, MetadataFileName)
 	err := f.File.Open(filePath)
 	if err != nil {
 		return err
 	}
+
+	if err := f.readHeader(); err != nil {
+		return fmt.Errorf("failed to read header of metadata file. %w", err)
+	}
+
+	// resume appending after the records already written on the file
+	size, err := f.File.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get file size. %w", err)
+	}
+
+	f.offset = f.baseOffset + size - f.headerSize
 	return nil
 }
 
@@ -68,32 +104,77 @@ func (f *File) Close() error {
 }
 
 func (f *File) Write(metadata Data) (int64, error) {
-	itemOffset := f.offset
-	buf := EncodeMetadata(metadata)
-	if err := f.File.Write(buf); err != nil {
-		return 0, fmt.Errorf("failed to write metadata. %w", err)
+	offsets, err := f.WriteBatch([]Data{metadata})
+	if err != nil {
+		return 0, err
 	}
+	return offsets[0], nil
+}
 
-	if f.syncAfterWrite {
-		if err := f.File.Sync(); err != nil {
-			return 0, fmt.Errorf("failed to sync metadata. %w", err)
-		}
+// WriteBatch writes metadata with a single write and returns offset of each metadata
+func (f *File) WriteBatch(metadata []Data) ([]int64, error) {
+	offsets := make([]int64, 0, len(metadata))
+	buf := make([]byte, 0)
+	for _, m := range metadata {
+		offsets = append(offsets, f.offset+int64(len(buf)))
+		buf = append(buf, EncodeMetadata(m)...)
+	}
+
+	if err := f.File.Write(buf); err != nil {
+		return nil, fmt.Errorf("failed to write metadata. %w", err)
 	}
 
 	f.offset += int64(len(buf))
-	f.lastMetadata = metadata
-	return itemOffset, nil
+	return offsets, nil
 }
 
 func (f *File) Read(offset int64, len int) (Data, error) {
-	data, err := f.File.ReadAt(offset, len)
+	if offset < f.baseOffset {
+		return Data{}, errs.New("read", f.File.Path(), fmt.Errorf("metadata at %d is truncated. %w", offset, errs.ErrCompacted))
+	}
+
+	data, err := f.File.ReadAt(f.position(offset), len)
 	if err != nil {
 		return Data{}, fmt.Errorf("failed to read metadata. %w", err)
 	}
 
 	metadata, err := DecodeMetadata(data)
 	if err != nil {
-		return Data{}, fmt.Errorf("failed to decode metadata. %w", err)
+		return Data{}, f.decodeError(offset, err)
+	}
+
+	return metadata, nil
+}
+
+// ReadRange reads consecutive metadata written on range of size from offset with a single read
+func (f *File) ReadRange(offset int64, size int) ([]Data, error) {
+	if offset < f.baseOffset {
+		return nil, errs.New("read", f.File.Path(), fmt.Errorf("metadata at %d is truncated. %w", offset, errs.ErrCompacted))
+	}
+
+	buf, err := f.File.ReadAt(f.position(offset), size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata. %w", err)
+	}
+
+	metadata := make([]Data, 0)
+	for begin := 0; begin < len(buf); {
+		if len(buf)-begin < metadataHeaderByteSize {
+			return nil, f.decodeError(offset+int64(begin), errors.New("partial header"))
+		}
+
+		end := begin + RecordSize(buf[begin:])
+		if end <= begin || end > len(buf) {
+			return nil, f.decodeError(offset+int64(begin), errors.New("invalid size"))
+		}
+
+		m, err := DecodeMetadata(buf[begin:end])
+		if err != nil {
+			return nil, f.decodeError(offset+int64(begin), err)
+		}
+
+		metadata = append(metadata, m)
+		begin = end
 	}
 
 	return metadata, nil
@@ -103,20 +184,122 @@ func (f *File) LastOffset() int64 {
 	return f.offset
 }
 
-func (f *File) Rollback() error {
+// BaseOffset returns offset of the first metadata on the file
+func (f *File) BaseOffset() int64 {
+	return f.baseOffset
+}
+
+// Truncate truncates metadata file to size and moves write offset to the end of file
+func (f *File) Truncate(size int64) error {
+	if size < f.baseOffset {
+		size = f.baseOffset
+	}
+
+	if err := f.File.Truncate(f.position(size)); err != nil {
+		return fmt.Errorf("failed to truncate metadata file. %w", err)
+	}
+
+	f.offset = size
+	return nil
+}
+
+// TruncateFront removes all metadata before offset from the file.
+// file is rewritten with header of new base offset and replaced atomically.
+func (f *File) TruncateFront(offset int64) error {
+	if f.readOnly {
+		return errs.New("truncate", f.File.Path(), errs.ErrReadOnly)
+	}
+
+	if offset <= f.baseOffset {
+		return nil
+	}
+
+	if offset > f.offset {
+		return fmt.Errorf("offset out of range. %d", offset)
+	}
+
+	buf := EncodeFileHeader(offset)
+	if offset < f.offset {
+		remained, err := f.File.ReadAt(f.position(offset), int(f.offset-offset))
+		if err != nil {
+			return fmt.Errorf("failed to read metadata. %w", err)
+		}
+		buf = append(buf, remained...)
+	}
+
+	filePath := f.File.Path()
+	if err := file.Rewrite(filePath, buf); err != nil {
+		return fmt.Errorf("failed to rewrite metadata file. %w", err)
+	}
+
+	// reopen replaced file
+	if err := f.File.Close(); err != nil {
+		return fmt.Errorf("failed to close metadata file. %w", err)
+	}
+
+	return f.Open()
+}
+
+// decodeError returns error of metadata at offset which can not be decoded
+func (f *File) decodeError(offset int64, err error) error {
+	return errs.New("decode", f.File.Path(), fmt.Errorf("%w. metadata at %d. %v", errs.ErrCorrupted, offset, err))
+}
+
+// position returns position of metadata of offset on the file
+func (f *File) position(offset int64) int64 {
+	return offset - f.baseOffset + f.headerSize
+}
+
+// readHeader reads header of the file. header is written on new file.
+func (f *File) readHeader() error {
 	size, err := f.File.Size()
 	if err != nil {
 		return fmt.Errorf("failed to get file size. %w", err)
 	}
 
-	if size < int64(f.lastMetadata.Size) {
+	f.headerSize, f.baseOffset = 0, 0
+	if size == 0 {
+		if f.readOnly {
+			return nil
+		}
+		return f.writeHeader()
+	}
+
+	headerSize := int64(fileHeaderByteSize)
+	if size < headerSize {
+		headerSize = size
+	}
+
+	buf, err := f.File.ReadAt(0, int(headerSize))
+	if err != nil {
+		return fmt.Errorf("failed to read header. %w", err)
+	}
+
+	header, err := DecodeFileHeader(buf)
+	switch {
+	case errors.Is(err, ErrNoFileHeader):
+		// metadata file written by previous version
 		return nil
+	case err != nil && size < fileHeaderByteSize && !f.readOnly:
+		// header was torn while creating file
+		if err := f.File.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate torn header. %w", err)
+		}
+		return f.writeHeader()
+	case err != nil:
+		return err
 	}
 
-	targetSize := size - int64(f.lastMetadata.Size)
-	if err := f.File.Truncate(targetSize); err != nil {
-		return fmt.Errorf("failed to truncate metadata file. %w", err)
+	f.headerSize = fileHeaderByteSize
+	f.baseOffset = header.BaseOffset
+	return nil
+}
+
+func (f *File) writeHeader() error {
+	if err := f.File.Write(EncodeFileHeader(0)); err != nil {
+		return fmt.Errorf("failed to write header. %w", err)
 	}
 
+	f.headerSize = fileHeaderByteSize
 	return nil
 }
@@ -25,20 +25,53 @@ SOFTWARE.
 package metadata
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 
 	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/errs"
 )
 
 const (
 	metadataHeaderByteSize = 12
+
+	// hashedFlag is set on the highest bit of size of metadata which has chaining hash after metadata of logs
+	hashedFlag = 1 << 31
+
+	// FileHeaderMagic is "WALM", written on the head of metadata file
+	FileHeaderMagic = 0x57414c4d
+
+	// FormatVersion is the version of metadata file written by this package
+	FormatVersion = 1
+
+	fileHeaderByteSize = 16
 )
 
+// ErrNoFileHeader is returned when metadata file does not start with header
+var ErrNoFileHeader = errors.New("metadata file has no header")
+
+// FileHeader is written on the head of metadata file.
+// BaseOffset is the offset of the first metadata on the file, which is not 0 after front of file is truncated.
+// metadata file written by previous version has no header, and its base offset is 0.
+type FileHeader struct {
+	Version    uint32
+	BaseOffset int64
+}
+
+// Layout of encoded Data:
+// +-----------+------------+----- ... -----+-------------------+
+// | Size (4B) | Index (8B) | LogMetadata   | Hash (32B)        |
+// +-----------+------------+----- ... -----+-------------------+
+// Hash is written only on metadata of chained log, and the highest bit of Size is set for it.
 type Data struct {
 	Size        int
 	Index       int64
 	LogMetadata []entry.LogMetadata
+
+	// Hash is chaining hash of log. nil if log is not chained.
+	Hash []byte
 }
 
 func NewMetadata(index int64, m []entry.LogMetadata) Data {
@@ -49,15 +82,66 @@ func NewMetadata(index int64, m []entry.LogMetadata) Data {
 	}
 }
 
+// NewHashedMetadata returns metadata of log which has chaining hash
+func NewHashedMetadata(index int64, m []entry.LogMetadata, hash []byte) Data {
+	data := NewMetadata(index, m)
+	data.Size += entry.HashByteLen
+	data.Hash = hash
+	return data
+}
+
+// RecordSize returns size of metadata encoded at the beginning of data
+func RecordSize(data []byte) int {
+	return int(binary.BigEndian.Uint32(data[0:4]) &^ hashedFlag)
+}
+
+// EncodeFileHeader encodes header of metadata file.
+// Layout: Magic(4) | Version(4) | BaseOffset(8)
+func EncodeFileHeader(baseOffset int64) []byte {
+	buf := make([]byte, fileHeaderByteSize)
+	binary.BigEndian.PutUint32(buf[0:4], FileHeaderMagic)
+	binary.BigEndian.PutUint32(buf[4:8], FormatVersion)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(baseOffset))
+	return buf
+}
+
+// DecodeFileHeader decodes header of metadata file. returns ErrNoFileHeader if data does not start with magic.
+func DecodeFileHeader(data []byte) (FileHeader, error) {
+	magic := EncodeFileHeader(0)[:4]
+	if len(data) < len(magic) && !bytes.HasPrefix(magic, data) ||
+		len(data) >= len(magic) && !bytes.Equal(data[:len(magic)], magic) {
+		return FileHeader{}, ErrNoFileHeader
+	}
+
+	if len(data) < fileHeaderByteSize {
+		return FileHeader{}, fmt.Errorf("invalid header size. %d", len(data))
+	}
+
+	h := FileHeader{
+		Version:    binary.BigEndian.Uint32(data[4:8]),
+		BaseOffset: int64(binary.BigEndian.Uint64(data[8:16])),
+	}
+
+	if h.Version > FormatVersion {
+		return FileHeader{}, fmt.Errorf("unsupported metadata file version %d", h.Version)
+	}
+	return h, nil
+}
+
 func EncodeMetadata(m Data) []byte {
+	size := uint32(m.Size)
+	if m.Hash != nil {
+		size |= hashedFlag
+	}
+
 	buf := make([]byte, metadataHeaderByteSize)
-	binary.BigEndian.PutUint32(buf[0:4], uint32(m.Size))
+	binary.BigEndian.PutUint32(buf[0:4], size)
 	binary.BigEndian.PutUint64(buf[4:12], uint64(m.Index))
 
 	for _, v := range m.LogMetadata {
 		buf = append(buf, entry.EncodeLogMetadata(v)...)
 	}
-	return buf
+	return append(buf, m.Hash...)
 }
 
 func DecodeMetadata(data []byte) (Data, error) {
@@ -65,7 +149,8 @@ func DecodeMetadata(data []byte) (Data, error) {
 		return Data{}, nil
 	}
 
-	size := int(binary.BigEndian.Uint32(data[:4]))
+	size := RecordSize(data)
+	hashed := binary.BigEndian.Uint32(data[:4])&hashedFlag != 0
 	index := int64(binary.BigEndian.Uint64(data[4:12]))
 
 	m := Data{
@@ -74,7 +159,22 @@ func DecodeMetadata(data []byte) (Data, error) {
 		LogMetadata: make([]entry.LogMetadata, 0),
 	}
 
-	segmentMetadataLen := (size - metadataHeaderByteSize) / entry.MetadataByteLen
+	// size of damaged record may exceed data
+	if size < metadataHeaderByteSize || size > len(data) {
+		return Data{}, fmt.Errorf("failed to decode metadata. invalid size %d of %d bytes. %w", size, len(data), errs.ErrCorrupted)
+	}
+
+	logMetadataSize := size - metadataHeaderByteSize
+	if hashed {
+		logMetadataSize -= entry.HashByteLen
+		if logMetadataSize < 0 {
+			return Data{}, fmt.Errorf("failed to decode metadata. invalid size %d. %w", size, errs.ErrCorrupted)
+		}
+
+		m.Hash = append([]byte{}, data[size-entry.HashByteLen:size]...)
+	}
+
+	segmentMetadataLen := logMetadataSize / entry.MetadataByteLen
 	for i := 0; i < segmentMetadataLen; i++ {
 		beginOffset := metadataHeaderByteSize + (i * entry.MetadataByteLen)
 		endOffset := beginOffset + entry.MetadataByteLen
@@ -25,9 +25,13 @@ SOFTWARE.
 package metadata
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"testing"
 
 	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/errs"
 )
 
 func TestNewMetadata(t *testing.T) {
@@ -130,3 +134,80 @@ func TestDecodeMetadata(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeMetadata_InvalidSize(t *testing.T) {
+	logMetadata := []entry.LogMetadata{{SegmentID: 1, Size: 1, Sequence: 0, CRC: 1, Offset: 0}}
+	hash := entry.ChainHash(nil, 1, []byte("test"))
+
+	for name, m := range map[string]Data{
+		"Plain":  NewMetadata(1, logMetadata),
+		"Hashed": NewHashedMetadata(1, logMetadata, hash),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, size := range []uint32{uint32(m.Size) + 24, 4} {
+				encoded := EncodeMetadata(m)
+				flag := binary.BigEndian.Uint32(encoded[0:4]) & hashedFlag
+				binary.BigEndian.PutUint32(encoded[0:4], size|flag)
+
+				if _, err := DecodeMetadata(encoded); !errors.Is(err, errs.ErrCorrupted) {
+					t.Errorf("expected %v for size %d, got %v", errs.ErrCorrupted, size, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	h, err := DecodeFileHeader(EncodeFileHeader(1234))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if h.Version != FormatVersion || h.BaseOffset != 1234 {
+		t.Errorf("expected version %d and base offset 1234, got %+v", FormatVersion, h)
+	}
+
+	// metadata file written by previous version starts with size of metadata
+	legacy := EncodeMetadata(NewMetadata(0, []entry.LogMetadata{{SegmentID: 0, Size: 1}}))
+	if _, err := DecodeFileHeader(legacy); !errors.Is(err, ErrNoFileHeader) {
+		t.Errorf("expected %v, got %v", ErrNoFileHeader, err)
+	}
+
+	// torn header
+	if _, err := DecodeFileHeader(EncodeFileHeader(0)[:2]); err == nil || errors.Is(err, ErrNoFileHeader) {
+		t.Errorf("expected error of torn header, got %v", err)
+	}
+}
+
+func TestDecodeMetadata_Hashed(t *testing.T) {
+	logMetadata := []entry.LogMetadata{
+		{SegmentID: 1, Size: 1, Sequence: 0, CRC: 1, Offset: 0},
+		{SegmentID: 2, Size: 2, Sequence: 1, CRC: 2, Offset: 16},
+	}
+	hash := entry.ChainHash(nil, 1, []byte("test"))
+	m := NewHashedMetadata(1, logMetadata, hash)
+
+	encoded := EncodeMetadata(m)
+	if len(encoded) != m.Size || RecordSize(encoded) != m.Size {
+		t.Errorf("expected encoded size %d, got %d", m.Size, len(encoded))
+	}
+
+	decoded, err := DecodeMetadata(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.Size != m.Size || len(decoded.LogMetadata) != 2 {
+		t.Errorf("expected metadata %v, got %v", m, decoded)
+	}
+	if !bytes.Equal(decoded.Hash, hash) {
+		t.Errorf("expected hash %x, got %x", hash, decoded.Hash)
+	}
+
+	// metadata without hash
+	decoded, err = DecodeMetadata(EncodeMetadata(NewMetadata(1, logMetadata)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.Hash != nil {
+		t.Errorf("expected no hash, got %x", decoded.Hash)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package segment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/entry"
+)
+
+const (
+	readAheadByteLen = 64 * 1024
+)
+
+// ErrPartialLog is returned by scanner when log on the tail of segment is not fully written
+var ErrPartialLog = fmt.Errorf("%w. log is not fully written", entry.ErrInvalidLog)
+
+// Scanner reads logs on segment file sequentially.
+// logs are read ahead in chunk to avoid a read syscall on each log.
+type Scanner struct {
+	segment *Segment
+
+	buf       []byte
+	bufOffset int64
+
+	offset    int64
+	log       entry.Log
+	logOffset int64
+	err       error
+}
+
+func newScanner(s *Segment, offset int64) *Scanner {
+	return &Scanner{
+		segment: s,
+		offset:  offset,
+	}
+}
+
+// Next reads next log. returns false when there is no more log or error occurred.
+// partial log on the tail of segment is reported as error.
+func (sc *Scanner) Next() bool {
+	if sc.err != nil {
+		return false
+	}
+
+	if sc.segment.version == LegacyVersion {
+		sc.err = errors.New("can not scan legacy segment")
+		return false
+	}
+
+	if sc.offset >= sc.segment.offset {
+		return false
+	}
+
+	header, err := sc.read(sc.offset, entry.LogHeaderByteLen)
+	if err != nil {
+		sc.err = err
+		return false
+	}
+
+	_, length, err := entry.DecodeLogHeader(header)
+	if err != nil {
+		sc.err = fmt.Errorf("failed to decode log at %d. %w", sc.offset, err)
+		return false
+	}
+
+	data, err := sc.read(sc.offset, entry.LogHeaderByteLen+length)
+	if err != nil {
+		sc.err = err
+		return false
+	}
+
+	log, err := entry.DecodeLog(data)
+	if err != nil {
+		sc.err = fmt.Errorf("failed to decode log at %d. %w", sc.offset, err)
+		return false
+	}
+
+	sc.log = log
+	sc.logOffset = sc.offset
+	sc.offset += int64(len(data))
+	return true
+}
+
+// Log returns log read by the last Next call
+func (sc *Scanner) Log() entry.Log {
+	return sc.log
+}
+
+// Offset returns offset of log read by the last Next call
+func (sc *Scanner) Offset() int64 {
+	return sc.logOffset
+}
+
+// Err returns error occurred while scanning
+func (sc *Scanner) Err() error {
+	return sc.err
+}
+
+// read returns size bytes at offset, filling read ahead buffer if needed
+func (sc *Scanner) read(offset int64, size int) ([]byte, error) {
+	end := offset + int64(size)
+	if end > sc.segment.offset {
+		return nil, fmt.Errorf("%w. log at %d exceeds segment size %d", ErrPartialLog, offset, sc.segment.offset)
+	}
+
+	if offset < sc.bufOffset || end > sc.bufOffset+int64(len(sc.buf)) {
+		readLen := int64(readAheadByteLen)
+		if readLen < int64(size) {
+			readLen = int64(size)
+		}
+		if offset+readLen > sc.segment.offset {
+			readLen = sc.segment.offset - offset
+		}
+
+		buf, err := sc.segment.file.ReadAt(offset, int(readLen))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read segment file. %w", err)
+		}
+		sc.buf = buf
+		sc.bufOffset = offset
+	}
+
+	begin := offset - sc.bufOffset
+	return sc.buf[begin : begin+int64(size)], nil
+}
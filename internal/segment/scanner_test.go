@@ -0,0 +1,133 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package segment
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ISSuh/wal/internal/entry"
+)
+
+func TestScanner_Next(t *testing.T) {
+	basePath := t.TempDir()
+	segment, err := NewSegment(0, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	payloads := [][]byte{
+		[]byte("test1"),
+		bytes.Repeat([]byte("a"), readAheadByteLen+10),
+		[]byte("test3"),
+	}
+	metadata := make([]entry.LogMetadata, 0)
+	for i, payload := range payloads {
+		m, err := segment.Append(entry.NewLog(int64(i), 0, payload))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		metadata = append(metadata, m)
+	}
+	segment.Close()
+
+	readOnly, err := NewReadOnlySegment(0, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer readOnly.Close()
+
+	scanner := readOnly.Scanner()
+	count := 0
+	for scanner.Next() {
+		log := scanner.Log()
+		if log.Index != int64(count) {
+			t.Errorf("expected index to be %d, got %d", count, log.Index)
+		}
+		if !bytes.Equal(log.PayLoad, payloads[count]) {
+			t.Errorf("expected payload of log %d to be matched", count)
+		}
+		if scanner.Offset() != metadata[count].Offset {
+			t.Errorf("expected offset to be %d, got %d", metadata[count].Offset, scanner.Offset())
+		}
+		count++
+	}
+
+	if scanner.Err() != nil {
+		t.Fatalf("expected no error, got %v", scanner.Err())
+	}
+	if count != len(payloads) {
+		t.Errorf("expected %d logs, got %d", len(payloads), count)
+	}
+}
+
+func TestScanner_TornLog(t *testing.T) {
+	basePath := t.TempDir()
+	segment, err := NewSegment(0, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := segment.Append(entry.NewLog(0, 0, []byte("test1"))); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := segment.Append(entry.NewLog(1, 0, []byte("test2"))); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := segment.Truncate(int64(segment.Size() - 1)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	segment.Close()
+
+	readOnly, err := NewReadOnlySegment(0, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer readOnly.Close()
+
+	scanner := readOnly.Scanner()
+	if !scanner.Next() {
+		t.Fatalf("expected first log, got %v", scanner.Err())
+	}
+	if scanner.Next() {
+		t.Fatalf("expected torn log not to be read")
+	}
+	if !errors.Is(scanner.Err(), entry.ErrInvalidLog) {
+		t.Errorf("expected ErrInvalidLog, got %v", scanner.Err())
+	}
+}
+
+func TestNewReadOnlySegment(t *testing.T) {
+	basePath := t.TempDir()
+	if _, err := NewReadOnlySegment(0, basePath); err == nil {
+		t.Fatalf("expected error on opening segment which does not exist")
+	}
+
+	if _, err := os.Stat(basePath + "/segment_0"); !os.IsNotExist(err) {
+		t.Errorf("expected segment file not to be created")
+	}
+}
@@ -25,25 +25,53 @@ SOFTWARE.
 package segment
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/ISSuh/wal/internal/crc"
 	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/errs"
 	"github.com/ISSuh/wal/internal/file"
 )
 
 const (
 	segmentFilePrefix = "segment"
+
+	// segmentMagic is the magic number at the beginning of segment file. "WALS"
+	segmentMagic = 0x57414c53
+
+	headerByteLen = 16
+)
+
+const (
+	// LegacyVersion is the version of headerless segment, which only has payload of logs
+	LegacyVersion = 0
+
+	// FormatVersion is the version of segment written by this package
+	FormatVersion = 1
 )
 
+// Layout of segment file header:
+// +------------+--------------+----------------+---------------+
+// | Magic (4B) | Version (4B) | SegmentID (4B) | Reserved (4B) |
+// +------------+--------------+----------------+---------------+
 type Segment struct {
 	id        int
+	version   int
 	size      int
 	offset    int64
 	lastIndex int64
 
 	file     file.File
+	buf      []byte
 	basePath string
+	readOnly bool
 }
 
 func NewSegment(id int, basePath string) (*Segment, error) {
@@ -63,11 +91,145 @@ func NewSegment(id int, basePath string) (*Segment, error) {
 	return s, nil
 }
 
+// NewReadOnlySegment opens existing segment file of id only for reading logs
+func NewReadOnlySegment(id int, basePath string) (*Segment, error) {
+	s := &Segment{
+		id:        id,
+		size:      0,
+		offset:    0,
+		lastIndex: 0,
+		file:      file.NewReadOnlyFile(),
+		basePath:  basePath,
+		readOnly:  true,
+	}
+
+	if err := s.open(id); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewMappedSegment opens existing sealed segment file of id on memory mapping.
+// logs are read from the mapping without syscall. segment file must not be changed while opened.
+func NewMappedSegment(id int, basePath string) (*Segment, error) {
+	s := &Segment{
+		id:        id,
+		size:      0,
+		offset:    0,
+		lastIndex: 0,
+		file:      file.NewMmapFile(),
+		basePath:  basePath,
+		readOnly:  true,
+	}
+
+	if err := s.open(id); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Path returns path of segment file of id on base path
+func Path(id int, basePath string) string {
+	return fmt.Sprintf("%s/%s_%d", basePath, segmentFilePrefix, id)
+}
+
+// Remove deletes segment file of id on base path and syncs directory to persist the removal
+func Remove(id int, basePath string) error {
+	filewithPath := Path(id, basePath)
+	if err := file.Remove(filewithPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove segment file. %w", err)
+	}
+	return nil
+}
+
+// Stat returns file info of segment file of id on base path
+func Stat(id int, basePath string) (os.FileInfo, error) {
+	filewithPath := Path(id, basePath)
+	return os.Stat(filewithPath)
+}
+
+// ClearFlags clears flags of log at offset on segment file of id and syncs it.
+// payload and crc of log are not changed.
+func ClearFlags(id int, basePath string, offset int64, flags uint8) error {
+	filewithPath := Path(id, basePath)
+	f, err := os.OpenFile(filewithPath, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open segment file. %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, entry.LogHeaderByteLen)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return fmt.Errorf("failed to read log header. %w", err)
+	}
+
+	log, _, err := entry.DecodeLogHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if log.Flags&flags == 0 {
+		return nil
+	}
+
+	if _, err := f.WriteAt([]byte{log.Flags &^ flags}, offset+entry.LogFlagsOffset); err != nil {
+		return fmt.Errorf("failed to write flags of log. %w", err)
+	}
+
+	return f.Sync()
+}
+
+// List returns ids of segment files on base path in ascending order
+func List(basePath string) ([]int, error) {
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory. %w", err)
+	}
+
+	ids := make([]int, 0)
+	prefix := segmentFilePrefix + "_"
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(name, prefix))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Append writes log on file. appended log is durable after Sync.
 func (s *Segment) Append(e entry.Log) (entry.LogMetadata, error) {
-	if err := s.write(e); err != nil {
+	m, err := s.Buffer(e)
+	if err != nil {
+		return entry.LogMetadata{}, err
+	}
+
+	if err := s.Flush(); err != nil {
 		return entry.LogMetadata{}, err
 	}
 
+	return m, nil
+}
+
+// Buffer appends log on write buffer. buffered logs are written on file by Flush.
+func (s *Segment) Buffer(e entry.Log) (entry.LogMetadata, error) {
+	if s.version == LegacyVersion {
+		return entry.LogMetadata{}, errors.New("can not append log to legacy segment")
+	}
+
+	data := entry.EncodeLog(e)
+	s.buf = append(s.buf, data...)
+
 	crc := crc.Encode(e.PayLoad)
 	m := entry.LogMetadata{
 		SegmentID: s.id,
@@ -77,29 +239,158 @@ func (s *Segment) Append(e entry.Log) (entry.LogMetadata, error) {
 		CRC:       crc,
 	}
 
-	s.offset += int64(m.Size)
-	s.size += m.Size
+	s.offset += int64(len(data))
+	s.size += len(data)
 	return m, nil
 }
 
+// Flush writes buffered logs on file with a single write
+func (s *Segment) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+
+	if err := s.file.Write(s.buf); err != nil {
+		return fmt.Errorf("failed to write segment file. %w", err)
+	}
+
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Read reads log of which payload size is len at offset
 func (s *Segment) Read(offset int64, len int) (entry.Log, error) {
-	data, err := s.file.ReadAt(offset, len)
+	data, err := s.file.ReadAt(offset, int(s.LogSize(len)))
 	if err != nil {
-		return entry.Log{}, fmt.Errorf("failed to read segment file. %w", err)
+		return entry.Log{}, s.wrapError("read", offset, err)
+	}
+
+	decode := entry.DecodeLog
+	if s.version == LegacyVersion {
+		decode = entry.DecodeLegacyLog
 	}
 
-	log, err := entry.DecodeLog(data)
+	log, err := decode(data)
 	if err != nil {
-		return entry.Log{}, fmt.Errorf("failed to decode segment file. %w", err)
+		return entry.Log{}, s.wrapError("decode", offset, err)
 	}
 
 	return log, nil
 }
 
+// View calls fn with log of which payload size is len at offset.
+// payload refers to the mapping of segment without copy if segment is mapped, and must not be used after fn returns.
+func (s *Segment) View(offset int64, len int, fn func(entry.Log) error) error {
+	size := int(s.LogSize(len))
+
+	var data []byte
+	var err error
+	if viewer, ok := s.file.(file.Viewer); ok {
+		data, err = viewer.View(offset, size)
+	} else {
+		data, err = s.file.ReadAt(offset, size)
+	}
+	if err != nil {
+		return s.wrapError("read", offset, err)
+	}
+
+	decode := entry.DecodeLog
+	if s.version == LegacyVersion {
+		decode = entry.DecodeLegacyLog
+	}
+
+	log, err := decode(data)
+	if err != nil {
+		return s.wrapError("decode", offset, err)
+	}
+
+	return fn(log)
+}
+
+// ReadLogs reads logs of metadata with a single read of the range covering them.
+// metadata must be of logs on this segment.
+func (s *Segment) ReadLogs(metadata []entry.LogMetadata) ([]entry.Log, error) {
+	if len(metadata) == 0 {
+		return []entry.Log{}, nil
+	}
+
+	begin, end := metadata[0].Offset, int64(0)
+	for _, m := range metadata {
+		if m.Offset < begin {
+			begin = m.Offset
+		}
+		if logEnd := m.Offset + s.LogSize(m.Size); logEnd > end {
+			end = logEnd
+		}
+	}
+
+	data, err := s.file.ReadAt(begin, int(end-begin))
+	if err != nil {
+		return nil, s.wrapError("read", begin, err)
+	}
+
+	decode := entry.DecodeLog
+	if s.version == LegacyVersion {
+		decode = entry.DecodeLegacyLog
+	}
+
+	logs := make([]entry.Log, 0, len(metadata))
+	for _, m := range metadata {
+		logBegin := m.Offset - begin
+		log, err := decode(data[logBegin : logBegin+s.LogSize(m.Size)])
+		if err != nil {
+			return nil, s.wrapError("decode", m.Offset, err)
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, nil
+}
+
+// wrapError returns error of op at offset on the segment.
+// error of the segment file is annotated with id of the segment instead of being wrapped again.
+func (s *Segment) wrapError(op string, offset int64, err error) error {
+	if fileErr, ok := err.(*errs.Error); ok && fileErr.Path == s.file.Path() {
+		return fileErr.WithSegment(s.id, offset)
+	}
+	return errs.New(op, s.file.Path(), err).WithSegment(s.id, offset)
+}
+
+// LogSize returns size of log written on segment file of which payload size is len
+func (s *Segment) LogSize(len int) int64 {
+	if s.version == LegacyVersion {
+		return int64(len)
+	}
+	return int64(entry.LogHeaderByteLen + len)
+}
+
 func (s *Segment) ID() int {
 	return s.id
 }
 
+// Version returns format version of segment file
+func (s *Segment) Version() int {
+	return s.version
+}
+
+// Scanner returns scanner reading logs of segment sequentially from the first log
+func (s *Segment) Scanner() *Scanner {
+	return newScanner(s, s.dataOffset())
+}
+
+// ScannerAt returns scanner reading logs of segment sequentially from offset
+func (s *Segment) ScannerAt(offset int64) *Scanner {
+	if offset < s.dataOffset() {
+		offset = s.dataOffset()
+	}
+	return newScanner(s, offset)
+}
+
+// Empty reports whether segment has no log
+func (s *Segment) Empty() bool {
+	return s.offset <= s.dataOffset()
+}
+
 func (s *Segment) Size() int {
 	return s.size
 }
@@ -108,6 +399,23 @@ func (s *Segment) Offset() int64 {
 	return s.offset
 }
 
+// Truncate removes logs after size from segment
+func (s *Segment) Truncate(size int64) error {
+	if size < s.dataOffset() {
+		size = s.dataOffset()
+	}
+
+	if err := s.file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate segment file. %w", err)
+	}
+
+	// logs not flushed yet are discarded
+	s.buf = s.buf[:0]
+	s.size = int(size)
+	s.offset = size
+	return nil
+}
+
 func (s *Segment) Close() error {
 	if s.file != nil {
 		if err := s.file.Close(); err != nil {
@@ -125,22 +433,111 @@ func (s *Segment) Sync() error {
 }
 
 func (s *Segment) open(id int) error {
-	filewithPath := fmt.Sprintf("%s/%s_%d", s.basePath, segmentFilePrefix, id)
+	filewithPath := Path(id, s.basePath)
 	if err := s.file.Open(filewithPath); err != nil {
 		return fmt.Errorf("failed to open segment file. %w", err)
 	}
+
+	size, err := s.file.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get segment file size. %w", err)
+	}
+
+	if err := s.readHeader(size); err != nil {
+		return err
+	}
+
+	// resume appending after the logs already written on the file
+	size, err = s.file.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get segment file size. %w", err)
+	}
+
+	s.size = int(size)
+	s.offset = size
 	return nil
 }
 
-func (s *Segment) write(log entry.Log) error {
-	data := entry.EncodeLog(log)
-	if err := s.file.Write(data); err != nil {
-		return fmt.Errorf("failed to write segment file. %w", err)
+// readHeader reads header of segment file. header is written if file is new one.
+// file which does not start with magic number is treated as legacy headerless segment.
+func (s *Segment) readHeader(size int64) error {
+	header := encodeHeader(FormatVersion, s.id)
+	if size == 0 {
+		if s.readOnly {
+			s.version = FormatVersion
+			return nil
+		}
+		return s.writeHeader(header)
 	}
 
-	if err := s.file.Sync(); err != nil {
-		return fmt.Errorf("failed to write segment file. %w", err)
+	n := size
+	if n > headerByteLen {
+		n = headerByteLen
+	}
+
+	buf, err := s.file.ReadAt(0, int(n))
+	if err != nil {
+		return fmt.Errorf("failed to read segment header. %w", err)
+	}
+
+	magicLen := 4
+	if len(buf) < magicLen {
+		magicLen = len(buf)
+	}
+
+	if !bytes.Equal(buf[:magicLen], header[:magicLen]) {
+		s.version = LegacyVersion
+		return nil
+	}
+
+	// header was torn while creating segment. segment has no log yet.
+	if len(buf) < headerByteLen {
+		if s.readOnly {
+			s.version = FormatVersion
+			return nil
+		}
+
+		if err := s.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate segment file. %w", err)
+		}
+		return s.writeHeader(header)
+	}
+
+	version := int(binary.BigEndian.Uint32(buf[4:8]))
+	id := int(binary.BigEndian.Uint32(buf[8:12]))
+	if id != s.id {
+		return fmt.Errorf("segment id mismatch. %d != %d", id, s.id)
+	}
+
+	if version > FormatVersion {
+		return fmt.Errorf("unsupported segment version. %d", version)
+	}
+
+	s.version = version
+	return nil
+}
+
+func (s *Segment) writeHeader(header []byte) error {
+	if err := s.file.Write(header); err != nil {
+		return fmt.Errorf("failed to write segment header. %w", err)
 	}
 
+	s.version = FormatVersion
 	return nil
 }
+
+// dataOffset returns offset of the first log on segment file
+func (s *Segment) dataOffset() int64 {
+	if s.version == LegacyVersion {
+		return 0
+	}
+	return headerByteLen
+}
+
+func encodeHeader(version int, id int) []byte {
+	buf := make([]byte, headerByteLen)
+	binary.BigEndian.PutUint32(buf[0:4], segmentMagic)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(version))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(id))
+	return buf
+}
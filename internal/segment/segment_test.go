@@ -25,6 +25,8 @@ SOFTWARE.
 package segment
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/ISSuh/wal/internal/entry"
@@ -32,7 +34,7 @@ import (
 
 func TestNewSegment(t *testing.T) {
 	// Add test logic for NewSegment function
-	segment, err := NewSegment(1, "/tmp")
+	segment, err := NewSegment(1, t.TempDir())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -43,7 +45,7 @@ func TestNewSegment(t *testing.T) {
 
 func TestSegment_Append(t *testing.T) {
 	// Add test logic for Segment.Append function
-	segment, _ := NewSegment(1, "/tmp")
+	segment, _ := NewSegment(1, t.TempDir())
 	log := entry.Log{Sequence: 1, PayLoad: []byte("test")}
 	metadata, err := segment.Append(log)
 	if err != nil {
@@ -56,14 +58,14 @@ func TestSegment_Append(t *testing.T) {
 
 func TestSegment_Read(t *testing.T) {
 	// Add test logic for Segment.Read function
-	segment, _ := NewSegment(1, "/tmp")
+	segment, _ := NewSegment(1, t.TempDir())
 	log := entry.Log{Sequence: 1, PayLoad: []byte("test")}
 	_, err := segment.Append(log)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	readLog, err := segment.Read(0, len(log.PayLoad))
+	readLog, err := segment.Read(headerByteLen, len(log.PayLoad))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -74,9 +76,126 @@ func TestSegment_Read(t *testing.T) {
 
 func TestSegment_Close(t *testing.T) {
 	// Add test logic for Segment.Close function
-	segment, _ := NewSegment(1, "/tmp")
+	segment, _ := NewSegment(1, t.TempDir())
 	err := segment.Close()
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
+
+func TestSegment_Header(t *testing.T) {
+	basePath := t.TempDir()
+	segment, err := NewSegment(3, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if segment.Version() != FormatVersion {
+		t.Errorf("expected version to be %d, got %d", FormatVersion, segment.Version())
+	}
+	if !segment.Empty() {
+		t.Errorf("expected segment to be empty")
+	}
+	if segment.Size() != headerByteLen {
+		t.Errorf("expected size to be %d, got %d", headerByteLen, segment.Size())
+	}
+
+	log := entry.Log{Sequence: 1, PayLoad: []byte("test")}
+	metadata, err := segment.Append(log)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	segment.Close()
+
+	reopened, err := NewSegment(3, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.Empty() {
+		t.Errorf("expected segment not to be empty")
+	}
+	if reopened.Offset() != metadata.Offset+reopened.LogSize(len(log.PayLoad)) {
+		t.Errorf("expected offset to be %d, got %d", metadata.Offset+reopened.LogSize(len(log.PayLoad)), reopened.Offset())
+	}
+
+	readLog, err := reopened.Read(metadata.Offset, metadata.Size)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if readLog.Sequence != 1 || string(readLog.PayLoad) != "test" {
+		t.Errorf("expected payload to be 'test', got %s", string(readLog.PayLoad))
+	}
+}
+
+func TestSegment_Legacy(t *testing.T) {
+	basePath := t.TempDir()
+	filePath := fmt.Sprintf("%s/%s_%d", basePath, segmentFilePrefix, 0)
+	if err := os.WriteFile(filePath, []byte("legacypayload"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	segment, err := NewSegment(0, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer segment.Close()
+
+	if segment.Version() != LegacyVersion {
+		t.Errorf("expected version to be %d, got %d", LegacyVersion, segment.Version())
+	}
+
+	readLog, err := segment.Read(6, 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readLog.PayLoad) != "payload" {
+		t.Errorf("expected payload to be 'payload', got %s", string(readLog.PayLoad))
+	}
+
+	if _, err := segment.Append(entry.Log{PayLoad: []byte("test")}); err == nil {
+		t.Errorf("expected error on appending to legacy segment")
+	}
+}
+
+func TestSegment_Mapped(t *testing.T) {
+	basePath := t.TempDir()
+	segment, err := NewSegment(1, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	metadata, err := segment.Append(entry.Log{Sequence: 1, PayLoad: []byte("test")})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	segment.Close()
+
+	mapped, err := NewMappedSegment(1, basePath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer mapped.Close()
+
+	readLog, err := mapped.Read(metadata.Offset, metadata.Size)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readLog.PayLoad) != "test" {
+		t.Errorf("expected payload to be 'test', got %s", string(readLog.PayLoad))
+	}
+
+	err = mapped.View(metadata.Offset, metadata.Size, func(log entry.Log) error {
+		if string(log.PayLoad) != "test" {
+			t.Errorf("expected payload to be 'test', got %s", string(log.PayLoad))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := mapped.Append(entry.Log{PayLoad: []byte("test")}); err == nil {
+		t.Errorf("expected error on appending to mapped segment")
+	}
+}
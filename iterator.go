@@ -0,0 +1,459 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/index"
+	"github.com/ISSuh/wal/internal/metadata"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+const (
+	// iteratorWindowLen is the maximum number of logs read ahead at once
+	iteratorWindowLen = 256
+
+	// iteratorWindowByteSize is the maximum size of data read ahead at once
+	iteratorWindowByteSize = 1 * mb
+)
+
+// Iterator reads logs sequentially, forward or backward.
+// it only sees logs committed before it was created.
+type Iterator interface {
+	// Next moves iterator to the next log. reverse iterator moves to the previous log.
+	// returns false when there is no more log or error occurred.
+	Next() bool
+
+	// SeekTo positions iterator so that the next call of Next moves to the log of index.
+	// it is not named Seek to avoid confusion with io.Seeker.
+	SeekTo(index int64) error
+
+	// SeekToLast positions iterator so that the next call of Next moves to the last log
+	SeekToLast() error
+
+	// Index returns index of the current log
+	Index() int64
+
+	// Value returns data of the current log
+	Value() []byte
+
+	// Err returns error occurred while iterating
+	Err() error
+
+	// Close releases files opened by iterator
+	Close() error
+}
+
+type iteratorLog struct {
+	index int64
+	data  []byte
+}
+
+type iterator struct {
+	path    string
+	verify  bool
+	reverse bool
+	keys    KeyProvider
+
+	indexFile    *index.File
+	metadataFile *metadata.File
+	segments     map[int]*segment.Segment
+
+	// first and last are the range of logs visible to iterator
+	first int64
+	last  int64
+
+	// next is the index of the log to be read first on the next window
+	next int64
+
+	window    []iteratorLog
+	pos       int
+	windowErr error
+	current   iteratorLog
+	err       error
+	closed    bool
+}
+
+func (s *storage) NewIterator(from int64) (Iterator, error) {
+	return s.newIterator(from, false)
+}
+
+// NewReverseIterator returns iterator which reads logs backward from index of from
+func (s *storage) NewReverseIterator(from int64) (Iterator, error) {
+	return s.newIterator(from, true)
+}
+
+func (s *storage) newIterator(from int64, reverse bool) (*iterator, error) {
+	s.mutex.RLock()
+	last := s.indexFile.LastIndex()
+	err := s.checkClosed("iterate")
+	s.mutex.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if from < 0 {
+		return nil, newError("iterate", s.options.Path, ErrNotFound).WithIndex(from)
+	}
+
+	// reverse iterator starts from the last log if from is beyond it
+	if reverse && from > last {
+		from = last
+	}
+
+	indexFile := index.NewReadOnlyFile(s.options.Path)
+	if err := indexFile.Open(); err != nil {
+		return nil, fmt.Errorf("failed to open index file. %w", err)
+	}
+
+	metadataFile := metadata.NewReadOnlyFile(s.options.Path)
+	if err := metadataFile.Open(); err != nil {
+		indexFile.Close()
+		return nil, fmt.Errorf("failed to open metadata file. %w", err)
+	}
+
+	// reverse iterator on storage without log starts before the first index, and reads nothing
+	first := indexFile.FirstIndex()
+	if from < first && !(reverse && last < first) {
+		indexFile.Close()
+		metadataFile.Close()
+		return nil, newError("iterate", s.options.Path, ErrCompacted).WithIndex(from)
+	}
+
+	return &iterator{
+		path:         s.options.Path,
+		verify:       !s.options.SkipCRCVerification,
+		keys:         s.options.Encryption,
+		reverse:      reverse,
+		indexFile:    indexFile,
+		metadataFile: metadataFile,
+		segments:     make(map[int]*segment.Segment),
+		first:        first,
+		last:         last,
+		next:         from,
+		window:       make([]iteratorLog, 0),
+	}, nil
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil || it.closed {
+		return false
+	}
+
+	if it.pos >= len(it.window) {
+		if it.windowErr != nil {
+			it.err = it.windowErr
+			return false
+		}
+
+		if it.next < it.first || it.next > it.last {
+			return false
+		}
+
+		if err := it.load(); err != nil {
+			it.err = err
+			return false
+		}
+
+		if len(it.window) == 0 {
+			it.err = it.windowErr
+			return false
+		}
+	}
+
+	it.current = it.window[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *iterator) SeekTo(index int64) error {
+	if it.closed {
+		return newError("seek", it.path, ErrClosed)
+	}
+
+	if index < 0 {
+		return newError("seek", it.path, ErrNotFound).WithIndex(index)
+	}
+
+	if index < it.first {
+		return newError("seek", it.path, ErrCompacted).WithIndex(index)
+	}
+
+	if index > it.last {
+		return newError("seek", it.path, ErrNotFound).WithIndex(index)
+	}
+
+	it.next = index
+	it.window = it.window[:0]
+	it.pos = 0
+	it.windowErr = nil
+	it.err = nil
+	return nil
+}
+
+func (it *iterator) SeekToLast() error {
+	if it.last < it.first {
+		return newError("seek", it.path, ErrNotFound)
+	}
+	return it.SeekTo(it.last)
+}
+
+func (it *iterator) Index() int64 {
+	return it.current.index
+}
+
+func (it *iterator) Value() []byte {
+	return it.current.data
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+
+	errs := make([]error, 0)
+	for id, seg := range it.segments {
+		if err := seg.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(it.segments, id)
+	}
+
+	if err := it.indexFile.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := it.metadataFile.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// load reads ahead window of logs from the next index toward direction of iterator.
+// index and metadata of logs in window are read with a single read each,
+// and fragments on the same segment are read with a single read.
+func (it *iterator) load() error {
+	lo, hi := it.next, it.next+iteratorWindowLen-1
+	if it.reverse {
+		lo, hi = it.next-iteratorWindowLen+1, it.next
+	}
+	if lo < it.first {
+		lo = it.first
+	}
+	if hi > it.last {
+		hi = it.last
+	}
+
+	indexes, err := it.indexFile.ReadRange(lo, int(hi-lo+1))
+	if err != nil {
+		return fmt.Errorf("failed to read index. %w", err)
+	}
+
+	first, last := indexes[0], indexes[len(indexes)-1]
+	metadataSize := last.MetadataOffset + int64(last.MetadataSize) - first.MetadataOffset
+	metadata, err := it.metadataFile.ReadRange(first.MetadataOffset, int(metadataSize))
+	if err != nil {
+		return fmt.Errorf("failed to read metadata. %w", err)
+	}
+
+	if len(metadata) != len(indexes) {
+		return fmt.Errorf("metadata of index %d - %d is mismatched", first.Index, last.Index)
+	}
+
+	for i, m := range metadata {
+		if m.Index != indexes[i].Index {
+			return fmt.Errorf("metadata of index %d is mismatched", indexes[i].Index)
+		}
+
+		sort.Slice(m.LogMetadata, func(a, b int) bool {
+			return m.LogMetadata[a].Sequence < m.LogMetadata[b].Sequence
+		})
+	}
+
+	// serve logs in order of direction, and trim window to limit size of data read ahead
+	if it.reverse {
+		for i, j := 0, len(metadata)-1; i < j; i, j = i+1, j-1 {
+			metadata[i], metadata[j] = metadata[j], metadata[i]
+		}
+	}
+
+	size := 0
+	for i, m := range metadata {
+		for _, l := range m.LogMetadata {
+			size += l.Size
+		}
+
+		if size >= iteratorWindowByteSize {
+			metadata = metadata[:i+1]
+			break
+		}
+	}
+
+	window, err := it.readWindow(metadata)
+	if err != nil {
+		return err
+	}
+
+	it.window = window
+	it.pos = 0
+	if it.reverse {
+		it.next -= int64(len(metadata))
+	} else {
+		it.next += int64(len(metadata))
+	}
+	it.releaseSegments(metadata)
+	return nil
+}
+
+// readWindow reads logs of metadata. if reading at once fails,
+// logs are read one by one to serve logs before the broken log.
+func (it *iterator) readWindow(metadata []metadata.Data) ([]iteratorLog, error) {
+	window, err := it.readWindowAtOnce(metadata)
+	if err == nil {
+		return window, nil
+	}
+
+	window = make([]iteratorLog, 0, len(metadata))
+	for _, m := range metadata {
+		data, err := it.readLog(m)
+		if err != nil {
+			it.windowErr = err
+			break
+		}
+		window = append(window, iteratorLog{index: m.Index, data: data})
+	}
+	return window, nil
+}
+
+func (it *iterator) readWindowAtOnce(metadata []metadata.Data) ([]iteratorLog, error) {
+	type position struct {
+		log      int
+		fragment int
+	}
+
+	// group fragments by segment
+	segmentIDs := make([]int, 0)
+	fragments := make(map[int][]entry.LogMetadata)
+	positions := make(map[int][]position)
+	logs := make([][]entry.Log, len(metadata))
+	for i, m := range metadata {
+		logs[i] = make([]entry.Log, len(m.LogMetadata))
+		for j, l := range m.LogMetadata {
+			if _, exist := fragments[l.SegmentID]; !exist {
+				segmentIDs = append(segmentIDs, l.SegmentID)
+			}
+			fragments[l.SegmentID] = append(fragments[l.SegmentID], l)
+			positions[l.SegmentID] = append(positions[l.SegmentID], position{log: i, fragment: j})
+		}
+	}
+
+	for _, id := range segmentIDs {
+		seg, err := it.segment(id)
+		if err != nil {
+			return nil, err
+		}
+
+		segmentLogs, err := seg.ReadLogs(fragments[id])
+		if err != nil {
+			return nil, err
+		}
+
+		for i, p := range positions[id] {
+			logs[p.log][p.fragment] = segmentLogs[i]
+		}
+	}
+
+	window := make([]iteratorLog, 0, len(metadata))
+	for i, m := range metadata {
+		data, err := assembleLog(it.path, m.Index, m.LogMetadata, logs[i], it.verify, it.keys)
+		if err != nil {
+			return nil, err
+		}
+		window = append(window, iteratorLog{index: m.Index, data: data})
+	}
+	return window, nil
+}
+
+// readLog reads fragments of log one by one
+func (it *iterator) readLog(m metadata.Data) ([]byte, error) {
+	logs := make([]entry.Log, 0, len(m.LogMetadata))
+	for _, l := range m.LogMetadata {
+		seg, err := it.segment(l.SegmentID)
+		if err != nil {
+			return nil, err
+		}
+
+		log, err := seg.Read(l.Offset, l.Size)
+		if err != nil {
+			return nil, readLogError(it.path, m.Index, l, err)
+		}
+		logs = append(logs, log)
+	}
+
+	return assembleLog(it.path, m.Index, m.LogMetadata, logs, it.verify, it.keys)
+}
+
+// segment returns read only segment of id, opening it if it is not opened yet
+func (it *iterator) segment(id int) (*segment.Segment, error) {
+	if seg, exist := it.segments[id]; exist {
+		return seg, nil
+	}
+
+	seg, err := segment.NewReadOnlySegment(id, it.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment. %w", err)
+	}
+
+	it.segments[id] = seg
+	return seg, nil
+}
+
+// releaseSegments closes segments not used by logs of window
+func (it *iterator) releaseSegments(metadata []metadata.Data) {
+	used := make(map[int]bool)
+	for _, m := range metadata {
+		for _, l := range m.LogMetadata {
+			used[l.SegmentID] = true
+		}
+	}
+
+	for id, seg := range it.segments {
+		if !used[id] {
+			seg.Close()
+			delete(it.segments, id)
+		}
+	}
+}
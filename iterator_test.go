@@ -0,0 +1,380 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func writeTestLogs(t testing.TB, storage Storage, count int) [][]byte {
+	expected := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := []byte(fmt.Sprintf("test data %d %s", i, bytes.Repeat([]byte("a"), i%50)))
+		if _, err := storage.Write(data); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected = append(expected, data)
+	}
+	return expected
+}
+
+func TestIterator_Next(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 256,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 600)
+
+	for _, from := range []int64{0, 255, 599, 600} {
+		t.Run(fmt.Sprintf("From_%d", from), func(t *testing.T) {
+			it, err := storage.NewIterator(from)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer it.Close()
+
+			i := from
+			for it.Next() {
+				if it.Index() != i {
+					t.Fatalf("expected index to be %d, got %d", i, it.Index())
+				}
+				if !bytes.Equal(it.Value(), expected[i]) {
+					t.Fatalf("expected data to be %s, got %s", expected[i], it.Value())
+				}
+				i++
+			}
+
+			if it.Err() != nil {
+				t.Fatalf("expected no error, got %v", it.Err())
+			}
+			if i != int64(len(expected)) {
+				t.Errorf("expected iterator to stop at %d, got %d", len(expected), i)
+			}
+		})
+	}
+}
+
+func TestIterator_ConcurrentWrite(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 256,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 300)
+
+	it, err := storage.NewIterator(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer it.Close()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			if _, err := storage.Write([]byte("concurrent data")); err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+		}
+	}()
+
+	count := 0
+	for it.Next() {
+		if !bytes.Equal(it.Value(), expected[it.Index()]) {
+			t.Fatalf("expected data to be %s, got %s", expected[it.Index()], it.Value())
+		}
+		count++
+	}
+	wg.Wait()
+
+	if it.Err() != nil {
+		t.Fatalf("expected no error, got %v", it.Err())
+	}
+	if count != len(expected) {
+		t.Errorf("expected %d logs committed before iterator, got %d", len(expected), count)
+	}
+}
+
+func TestIterator_Corrupted(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 10)
+
+	content, err := os.ReadFile(path + "/segment_0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	f, err := os.OpenFile(path+"/segment_0", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := f.WriteAt([]byte("x"), int64(bytes.Index(content, expected[5]))); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	f.Close()
+
+	it, err := storage.NewIterator(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer it.Close()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	if count != 5 {
+		t.Errorf("expected 5 logs before corrupted log, got %d", count)
+	}
+
+	var corruptionErr *Error
+	if !errors.As(it.Err(), &corruptionErr) {
+		t.Fatalf("expected Error, got %v", it.Err())
+	}
+	if corruptionErr.Index != 5 {
+		t.Errorf("expected corrupted index to be 5, got %d", corruptionErr.Index)
+	}
+}
+
+func BenchmarkIterator(b *testing.B) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		b.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writeTestLogs(b, storage, 10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it, err := storage.NewIterator(0)
+		if err != nil {
+			b.Fatalf("expected no error, got %v", err)
+		}
+		for it.Next() {
+		}
+		if it.Err() != nil {
+			b.Fatalf("expected no error, got %v", it.Err())
+		}
+		it.Close()
+	}
+}
+
+func TestIterator_Reverse(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 256,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 600)
+
+	for _, from := range []int64{599, 300, 0} {
+		t.Run(fmt.Sprintf("From_%d", from), func(t *testing.T) {
+			it, err := storage.NewReverseIterator(from)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer it.Close()
+
+			i := from
+			for it.Next() {
+				if it.Index() != i {
+					t.Fatalf("expected index to be %d, got %d", i, it.Index())
+				}
+				if !bytes.Equal(it.Value(), expected[i]) {
+					t.Fatalf("expected data to be %s, got %s", expected[i], it.Value())
+				}
+				i--
+			}
+
+			if it.Err() != nil {
+				t.Fatalf("expected no error, got %v", it.Err())
+			}
+			if i != -1 {
+				t.Errorf("expected iterator to stop at -1, got %d", i)
+			}
+		})
+	}
+}
+
+func TestIterator_ReverseEmpty(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expectEmpty := func(t *testing.T, from int64) {
+		it, err := storage.NewReverseIterator(from)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer it.Close()
+
+		if it.Next() {
+			t.Errorf("expected no log, got %d", it.Index())
+		}
+		if it.Err() != nil {
+			t.Errorf("expected no error, got %v", it.Err())
+		}
+	}
+
+	t.Run("NoLog", func(t *testing.T) {
+		expectEmpty(t, 0)
+		expectEmpty(t, 10)
+	})
+
+	t.Run("TruncatedAll", func(t *testing.T) {
+		writeTestLogs(t, storage, 10)
+		if err := storage.TruncateFront(storage.LastIndex() + 1); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectEmpty(t, storage.LastIndex())
+		expectEmpty(t, 20)
+	})
+}
+
+func TestIterator_Seek(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 256,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 100)
+
+	t.Run("LastN", func(t *testing.T) {
+		it, err := storage.NewReverseIterator(0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer it.Close()
+
+		if err := it.SeekToLast(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		for i := 99; i > 89; i-- {
+			if !it.Next() {
+				t.Fatalf("expected log %d, got %v", i, it.Err())
+			}
+			if it.Index() != int64(i) || !bytes.Equal(it.Value(), expected[i]) {
+				t.Fatalf("expected log %d, got %d", i, it.Index())
+			}
+		}
+	})
+
+	t.Run("SeekTo", func(t *testing.T) {
+		it, err := storage.NewIterator(0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer it.Close()
+
+		for _, index := range []int64{50, 10, 99} {
+			if err := it.SeekTo(index); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !it.Next() {
+				t.Fatalf("expected log %d, got %v", index, it.Err())
+			}
+			if it.Index() != index || !bytes.Equal(it.Value(), expected[index]) {
+				t.Fatalf("expected log %d, got %d", index, it.Index())
+			}
+		}
+
+		if it.Next() {
+			t.Errorf("expected no log after the last log")
+		}
+
+		if err := it.SeekTo(100); err == nil {
+			t.Errorf("expected error on seeking out of range")
+		}
+	})
+}
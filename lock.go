@@ -0,0 +1,44 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/file"
+)
+
+// LockFileName is name of the file locked by writer of storage
+const LockFileName = "LOCK"
+
+// lockStorage locks storage on path for a writer. returns error wrapping ErrLocked if another writer holds the lock.
+// read only storage does not take the lock, so it can be opened alongside the writer.
+func lockStorage(path string) (*file.Lock, error) {
+	lock, err := file.TryLock(fmt.Sprintf("%s/%s", path, LockFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock storage. %w", err)
+	}
+	return lock, nil
+}
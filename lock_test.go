@@ -0,0 +1,77 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStorage_Lock(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	writer, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, writer, 3)
+
+	// another writer on the same path is rejected
+	_, err = NewStorage(Options{Path: path})
+	var walErr *Error
+	if !errors.Is(err, ErrLocked) || !errors.As(err, &walErr) || walErr.Path != path+"/"+LockFileName {
+		t.Fatalf("expected %v on %s, got %v", ErrLocked, path+"/"+LockFileName, err)
+	}
+
+	if _, err := Rebuild(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected %v, got %v", ErrLocked, err)
+	}
+
+	// read only storage is opened alongside the writer
+	reader, err := NewStorage(Options{Path: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := reader.Read(2); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	reader.Close()
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// lock is released on close
+	writer, err = NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if writer.LastIndex() != 2 {
+		t.Errorf("expected last index to be 2, got %d", writer.LastIndex())
+	}
+	writer.Close()
+}
@@ -0,0 +1,188 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStorage_MmapSegments(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+		MaxOpenSegments: 2,
+		MmapSegments:    true,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 30)
+
+	for round := 0; round < 2; round++ {
+		for i, data := range expected {
+			readData, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(readData) != string(data) {
+				t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+			}
+
+			err = storage.View(int64(i), func(viewData []byte) error {
+				if string(viewData) != string(data) {
+					t.Errorf("expected log %d to be %s, got %s", i, data, viewData)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+
+	// logs are still readable after segments are truncated
+	if err := storage.TruncateBack(10); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected = append(expected[:11], writeTestLogs(t, storage, 10)...)
+	for i, data := range expected {
+		readData, err := storage.Read(int64(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData) != string(data) {
+			t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+		}
+	}
+}
+
+func TestStorage_View(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+		MmapSegments:    true,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writeTestLogs(t, storage, 10)
+
+	errView := errors.New("view error")
+	err = storage.View(0, func([]byte) error {
+		return errView
+	})
+	if err != errView {
+		t.Errorf("expected error of callback, got %v", err)
+	}
+
+	err = storage.View(100, func([]byte) error {
+		t.Errorf("expected callback not to be called")
+		return nil
+	})
+	if err == nil {
+		t.Errorf("expected error on viewing log which does not exist")
+	}
+}
+
+func benchmarkReadSealed(b *testing.B, mmap bool, view bool) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 64 * kb,
+		MmapSegments:    mmap,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		b.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	const count = 1024
+	data := bytes.Repeat([]byte("a"), 256)
+	for i := 0; i < count; i++ {
+		if _, err := storage.Write(data); err != nil {
+			b.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	size := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the last logs are on the active segment
+		index := int64(i % (count / 2))
+		if view {
+			err = storage.View(index, func(data []byte) error {
+				size += len(data)
+				return nil
+			})
+		} else {
+			var readData []byte
+			readData, err = storage.Read(index)
+			size += len(readData)
+		}
+		if err != nil {
+			b.Fatalf("expected no error, got %v", err)
+		}
+	}
+	b.SetBytes(int64(size / b.N))
+}
+
+// BenchmarkReadSealed compares reading sealed segments with ReadAt and from mapping
+func BenchmarkReadSealed(b *testing.B) {
+	for _, bench := range []struct {
+		mmap bool
+		view bool
+	}{
+		{mmap: false, view: false},
+		{mmap: true, view: false},
+		{mmap: false, view: true},
+		{mmap: true, view: true},
+	} {
+		name := fmt.Sprintf("mmap_%t/view_%t", bench.mmap, bench.view)
+		b.Run(name, func(b *testing.B) {
+			benchmarkReadSealed(b, bench.mmap, bench.view)
+		})
+	}
+}
@@ -24,6 +24,8 @@ SOFTWARE.
 
 package wal
 
+import "time"
+
 const (
 	kb = 1024
 	mb = kb * 1024
@@ -31,22 +33,106 @@ const (
 )
 
 const (
-	defaultSegmentFileSize = 1 * gb
+	defaultSegmentFileSize     = 1 * gb
+	defaultMaxOpenSegments     = 64
+	defaultGroupCommitMaxBatch = 1024
+	defaultSyncEveryN          = 1024
+	defaultSyncInterval        = 1 * time.Second
 )
 
 type Options struct {
 	// BasePath is the directory to store the log files.
 	Path string
 
+	// ReadOnly is a flag to open existing storage only for reading logs.
+	// files are never changed, so storage can be opened while another process writes on it.
+	// logs committed after storage is opened are not visible. read only storage does not take the lock of writer.
+	ReadOnly bool
+
 	// SegmentFileSize is the maximum size of a segment file.
 	SegmentFileSize int
 
-	// Sync is a flag to enable/disable fsync when append log on the segment file.
+	// MaxEntrySize is the maximum size of data of a log. larger log is not written and ErrEntryTooLarge is returned.
+	// no limit if it is zero.
+	MaxEntrySize int
+
+	// SyncAfterWrite is a flag to sync files after every write.
+	// it is used when SyncPolicy is not set. true is same as SyncAlways, false is same as SyncOnRollOnly.
 	SyncAfterWrite bool
+
+	// SyncPolicy decides when segment, metadata and index files are synced.
+	SyncPolicy SyncPolicy
+
+	// MaxOpenSegments is the maximum number of sealed segment files kept opened for reading.
+	// the least recently read segment is closed when more segments are read.
+	MaxOpenSegments int
+
+	// MmapSegments is a flag to map sealed segment files on memory for reading.
+	// reading logs of sealed segment becomes a copy from the mapping, and View gives them without copy.
+	MmapSegments bool
+
+	// CacheIndex is a flag to keep records of index file on memory, so finding metadata of log needs no syscall.
+	// records are loaded when storage is opened, and takes 20 bytes of memory per log.
+	CacheIndex bool
+
+	// CacheMetadata is a flag to keep records of metadata file on memory, so finding location of log needs no syscall.
+	CacheMetadata bool
+
+	// Compression is id of codec which compresses payload of logs before written. default is CodecNone.
+	// logs compressed with other codecs are still readable, so it can be changed on existing storage.
+	Compression CodecID
+
+	// Encryption is provider of keys which encrypt payload of logs with AES-GCM. encryption is disabled if it is nil.
+	// logs written before it is set are still readable, but encrypted logs can not be read without it.
+	Encryption KeyProvider
+
+	// HashChain is a flag to chain logs with SHA-256 hash to detect modified or removed logs.
+	// hash over hash of the previous log, index and stored payload of log is written on its metadata.
+	HashChain bool
+
+	// SkipCRCVerification is a flag to skip crc check of log on read. useful for hot read path.
+	SkipCRCVerification bool
+
+	// Retention removes the oldest sealed segments and their logs automatically. disabled if no limit is set.
+	Retention RetentionPolicy
+
+	// GroupCommit is a flag to commit logs of concurrent writers together.
+	// one of writers flushes and syncs queued logs at once, instead of each writer syncing its own log.
+	GroupCommit bool
+
+	// GroupCommitMaxBatch is the maximum number of logs committed together.
+	GroupCommitMaxBatch int
+
+	// GroupCommitMaxWait is how long the committing writer waits for other writers to join.
+	// zero commits logs queued so far without waiting.
+	GroupCommitMaxWait time.Duration
 }
 
 func (o *Options) setDefaultIfEmpty() {
 	if o.SegmentFileSize == 0 {
 		o.SegmentFileSize = defaultSegmentFileSize
 	}
+
+	if o.MaxOpenSegments <= 0 {
+		o.MaxOpenSegments = defaultMaxOpenSegments
+	}
+
+	if o.SyncPolicy.Mode == 0 {
+		o.SyncPolicy.Mode = SyncOnRollOnly
+		if o.SyncAfterWrite {
+			o.SyncPolicy.Mode = SyncAlways
+		}
+	}
+
+	if o.SyncPolicy.Mode == SyncEveryN && o.SyncPolicy.N <= 0 {
+		o.SyncPolicy.N = defaultSyncEveryN
+	}
+
+	if o.SyncPolicy.Mode == SyncInterval && o.SyncPolicy.Interval <= 0 {
+		o.SyncPolicy.Interval = defaultSyncInterval
+	}
+
+	if o.GroupCommitMaxBatch == 0 {
+		o.GroupCommitMaxBatch = defaultGroupCommitMaxBatch
+	}
 }
@@ -0,0 +1,100 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/index"
+	"github.com/ISSuh/wal/internal/metadata"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+// openReadOnly opens existing storage only for reading logs. files are never changed, so storage can be opened
+// while another process writes on it. logs committed after storage is opened are not visible.
+func openReadOnly(option Options, codec Codec) (*storage, error) {
+	// files replaced by interrupted rebuild do not match with each other, and only writer can rebuild them again
+	if rebuildInterrupted(option.Path) {
+		return nil, newError("open", option.Path, fmt.Errorf("%w. rebuild was interrupted", ErrCorrupted))
+	}
+
+	indexFile := index.NewReadOnlyFile(option.Path)
+	if err := indexFile.Open(); err != nil {
+		return nil, fmt.Errorf("failed to open index file. %w", err)
+	}
+
+	metadataFile := metadata.NewReadOnlyFile(option.Path)
+	if err := metadataFile.Open(); err != nil {
+		indexFile.Close()
+		return nil, fmt.Errorf("failed to open metadata file. %w", err)
+	}
+
+	s := &storage{
+		options:       option,
+		codec:         codec,
+		segments:      newSegmentCache(option.Path, option.MaxOpenSegments, option.MmapSegments),
+		indexFile:     indexFile,
+		metadataFile:  metadataFile,
+		committed:     make(chan struct{}),
+		closed:        make(chan struct{}),
+		subscriptions: make(map[*subscription]struct{}),
+	}
+
+	segmentIDs, err := segment.List(option.Path)
+	if err != nil {
+		s.closeFiles()
+		return nil, fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	if len(segmentIDs) == 0 {
+		s.closeFiles()
+		return nil, fmt.Errorf("no segment on %s", option.Path)
+	}
+
+	// the last segment may be appended by writer, so it is not cached
+	s.segment, err = segment.NewReadOnlySegment(segmentIDs[len(segmentIDs)-1], option.Path)
+	if err != nil {
+		s.closeFiles()
+		return nil, fmt.Errorf("failed to open segment. %w", err)
+	}
+
+	if err := s.loadHeadHash(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	s.syncedIndex = indexFile.LastIndex()
+	return s, nil
+}
+
+// closeFiles closes every file opened so far, when storage fails to be opened
+func (s *storage) closeFiles() {
+	if s.segment != nil {
+		s.segment.Close()
+	}
+	s.segments.close()
+	s.indexFile.Close()
+	s.metadataFile.Close()
+}
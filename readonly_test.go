@@ -0,0 +1,123 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage_ReadOnly(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	if _, err := NewStorage(Options{Path: path, ReadOnly: true}); err == nil {
+		t.Errorf("expected error on opening storage which does not exist")
+	}
+
+	writer, err := NewStorage(Options{Path: path, SegmentFileSize: 128})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer writer.Close()
+
+	expected := writeTestLogs(t, writer, 20)
+
+	snapshot := func() map[string][]byte {
+		files, err := filepath.Glob(path + "/*")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		contents := make(map[string][]byte)
+		for _, file := range files {
+			if contents[file], err = os.ReadFile(file); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		return contents
+	}
+	before := snapshot()
+
+	// storage is opened as read only while writer uses it
+	reader, err := NewStorage(Options{Path: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if reader.FirstIndex() != 0 || reader.LastIndex() != 19 {
+		t.Errorf("expected range to be 0 - 19, got %d - %d", reader.FirstIndex(), reader.LastIndex())
+	}
+
+	for i, data := range expected {
+		readData, err := reader.Read(int64(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData) != string(data) {
+			t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+		}
+	}
+
+	if _, err := reader.Write([]byte("test")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected error %v, got %v", ErrReadOnly, err)
+	}
+	if err := reader.TruncateFront(5); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected error %v, got %v", ErrReadOnly, err)
+	}
+	if err := reader.TruncateBack(5); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected error %v, got %v", ErrReadOnly, err)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	after := snapshot()
+	if len(after) != len(before) {
+		t.Errorf("expected files not to be changed, got %d files, want %d", len(after), len(before))
+	}
+	for file, content := range before {
+		if !bytes.Equal(after[file], content) {
+			t.Errorf("expected %s not to be changed", file)
+		}
+	}
+
+	// writer is not disturbed by reader
+	expected = append(expected, writeTestLogs(t, writer, 5)...)
+	for i, data := range expected {
+		readData, err := writer.Read(int64(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData) != string(data) {
+			t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ISSuh/wal/internal/crc"
+	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/file"
+	"github.com/ISSuh/wal/internal/index"
+	"github.com/ISSuh/wal/internal/metadata"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+const (
+	rebuildFileSuffix    = ".rebuild"
+	rebuildFlushByteSize = 1 * mb
+)
+
+// RebuildMarkerFileName is name of the file which exists while rebuilt files replace index and metadata.
+// storage finding it on open rebuilds files again, since replaced metadata does not match with the old index.
+const RebuildMarkerFileName = "REBUILD"
+
+// RebuildReport describes logs found on segments while rebuilding
+type RebuildReport struct {
+	// FirstIndex is the index of the first rebuilt log. -1 if no log was found.
+	FirstIndex int64
+
+	// LastIndex is the index of the last rebuilt log. -1 if no log was found.
+	LastIndex int64
+
+	// Segments is the number of scanned segment files.
+	Segments int
+
+	// Err is the reason why scanning was stopped before the end of segments.
+	// logs after the broken log are not reachable from rebuilt files.
+	// log torn on the tail of the last written segment is reported, but does not fail rebuild.
+	Err error
+}
+
+// Rebuild reconstructs index and metadata files on path from segment files.
+// segments are scanned in id order, and rebuilt files replace damaged files.
+// if scanning stops before the torn tail of segments, files are not replaced and error wrapping ErrCorrupted is returned.
+// if replacing is interrupted by crash, storage rebuilds files again on the next open.
+// storage on path must not be opened while rebuilding, and ErrLocked is returned if it is opened by writer.
+func Rebuild(path string) (RebuildReport, error) {
+	return lockAndRebuild(path, false)
+}
+
+// ForceRebuild is Rebuild which replaces files even if scanning stopped at broken log.
+// logs after the broken log are lost from rebuilt files.
+func ForceRebuild(path string) (RebuildReport, error) {
+	return lockAndRebuild(path, true)
+}
+
+func lockAndRebuild(path string, force bool) (RebuildReport, error) {
+	report := RebuildReport{
+		FirstIndex: -1,
+		LastIndex:  -1,
+	}
+
+	lock, err := lockStorage(path)
+	if err != nil {
+		return report, err
+	}
+	defer lock.Unlock()
+
+	return rebuild(path, false, force)
+}
+
+// rebuild reconstructs index and metadata files on path. caller must hold lock of storage.
+// hash chain is recomputed if chained is set, or the first log on old files has hash.
+// files are replaced by partial result only if force is set.
+func rebuild(path string, chained, force bool) (RebuildReport, error) {
+	report := RebuildReport{
+		FirstIndex: -1,
+		LastIndex:  -1,
+	}
+
+	segmentIDs, err := segment.List(path)
+	if err != nil {
+		return report, fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	indexPath := fmt.Sprintf("%s/%s", path, index.IndexFileName)
+	metadataPath := fmt.Sprintf("%s/%s", path, metadata.MetadataFileName)
+
+	indexWriter, err := newRebuildWriter(indexPath + rebuildFileSuffix)
+	if err != nil {
+		return report, err
+	}
+	defer indexWriter.close()
+
+	metadataWriter, err := newRebuildWriter(metadataPath + rebuildFileSuffix)
+	if err != nil {
+		return report, err
+	}
+	defer metadataWriter.close()
+
+	if err := metadataWriter.write(metadata.EncodeFileHeader(0)); err != nil {
+		return report, err
+	}
+
+	// old files are read until scanning ends, and closed before they are replaced
+	old := openOldFiles(path)
+	compacted := old.firstIndex()
+	builder := rebuilder{
+		compacted:  compacted,
+		chained:    chained || old.hash(compacted) != nil,
+		old:        old,
+		firstIndex: -1,
+		lastIndex:  -1,
+		assembled:  -1,
+		logs:       make([]entry.LogMetadata, 0),
+		batch:      make([]metadata.Data, 0),
+	}
+
+	// logs after torn tail of the last written segment were never committed
+	tornTail := false
+	for n, id := range segmentIDs {
+		report.Segments++
+		if err := builder.scan(id, path, indexWriter, metadataWriter); err != nil {
+			report.Err = err
+			tornTail = builder.torn && segmentsEmpty(path, segmentIDs[n+1:])
+			break
+		}
+	}
+
+	if len(builder.batch) > 0 && report.Err == nil {
+		first, last := builder.batch[0].Index, builder.batch[len(builder.batch)-1].Index
+		report.Err = fmt.Errorf("batch of log %d - %d is not completed", first, last)
+		tornTail = true
+	}
+	old.close()
+
+	report.FirstIndex = builder.firstIndex
+	report.LastIndex = builder.lastIndex
+
+	// rebuilt hash chain must not diverge from hashes on old metadata
+	if errors.Is(report.Err, ErrChainBroken) {
+		return report, newError("rebuild", path, report.Err)
+	}
+
+	if report.Err != nil && !tornTail && !force {
+		err := fmt.Errorf("%w. scanning stopped before the end of segments. %v", ErrCorrupted, report.Err)
+		return report, newError("rebuild", path, err)
+	}
+
+	if builder.lastIndex < 0 {
+		if err := indexWriter.write(index.EncodeHeader(builder.compacted)); err != nil {
+			return report, err
+		}
+	}
+
+	// files are replaced by two renames. marker is kept until both are replaced,
+	// so rebuild interrupted between them is repeated on the next open
+	markerPath := fmt.Sprintf("%s/%s", path, RebuildMarkerFileName)
+	if err := file.Rewrite(markerPath, nil); err != nil {
+		return report, fmt.Errorf("failed to create rebuild marker. %w", err)
+	}
+
+	if err := metadataWriter.commit(metadataPath); err != nil {
+		return report, fmt.Errorf("failed to replace metadata file. %w", err)
+	}
+
+	if err := indexWriter.commit(indexPath); err != nil {
+		return report, fmt.Errorf("failed to replace index file. %w", err)
+	}
+
+	if err := file.Remove(markerPath); err != nil {
+		return report, fmt.Errorf("failed to remove rebuild marker. %w", err)
+	}
+
+	return report, nil
+}
+
+// rebuildInterrupted reports whether rebuild of storage on path was interrupted while replacing files
+func rebuildInterrupted(path string) bool {
+	_, err := os.Stat(fmt.Sprintf("%s/%s", path, RebuildMarkerFileName))
+	return err == nil
+}
+
+// segmentsEmpty reports whether segments of ids on path have no log
+func segmentsEmpty(path string, ids []int) bool {
+	for _, id := range ids {
+		seg, err := segment.NewReadOnlySegment(id, path)
+		if err != nil {
+			return false
+		}
+
+		empty := seg.Empty()
+		seg.Close()
+		if !empty {
+			return false
+		}
+	}
+	return true
+}
+
+// oldFiles reads index and metadata files on path which are replaced by rebuilt files.
+// file which is lost or broken is left nil.
+type oldFiles struct {
+	indexFile    *index.File
+	metadataFile *metadata.File
+}
+
+func openOldFiles(path string) oldFiles {
+	old := oldFiles{}
+	indexFile := index.NewReadOnlyFile(path)
+	if err := indexFile.Open(); err != nil {
+		return old
+	}
+	old.indexFile = indexFile
+
+	metadataFile := metadata.NewReadOnlyFile(path)
+	if err := metadataFile.Open(); err != nil {
+		return old
+	}
+	old.metadataFile = metadataFile
+	return old
+}
+
+// firstIndex returns the first index recorded on old index file.
+// logs before it were removed by TruncateFront and are not rebuilt. returns 0 if index file is lost or broken.
+func (o oldFiles) firstIndex() int64 {
+	if o.indexFile == nil {
+		return 0
+	}
+	return o.indexFile.FirstIndex()
+}
+
+// hash returns hash of log of index i on old metadata. returns nil if metadata of the log is lost or not chained.
+func (o oldFiles) hash(i int64) []byte {
+	if o.indexFile == nil || o.metadataFile == nil {
+		return nil
+	}
+
+	index, err := o.indexFile.Read(i)
+	if err != nil || index.Index != i {
+		return nil
+	}
+
+	m, err := o.metadataFile.Read(index.MetadataOffset, index.MetadataSize)
+	if err != nil || m.Index != i {
+		return nil
+	}
+	return m.Hash
+}
+
+func (o oldFiles) close() {
+	if o.indexFile != nil {
+		o.indexFile.Close()
+	}
+	if o.metadataFile != nil {
+		o.metadataFile.Close()
+	}
+}
+
+// rebuilder reassembles fragments of logs scanned from segments into metadata and index
+type rebuilder struct {
+	// logs before compacted index are skipped
+	compacted int64
+
+	// firstIndex and lastIndex are the range of rebuilt logs
+	firstIndex int64
+	lastIndex  int64
+
+	// assembled is the index of the last reassembled log
+	assembled int64
+
+	// reassembled logs of batch not completed yet
+	batch []metadata.Data
+
+	// hash chain is recomputed from payload of fragments if chained,
+	// and checked against hash on old metadata of each log if it is readable
+	chained   bool
+	old       oldFiles
+	head      []byte
+	fragments [][]byte
+
+	// torn is set if scanning stopped at log not fully written on the tail of segment
+	torn bool
+
+	// fragments of log being reassembled
+	pending        bool
+	pendingIndex   int64
+	logs           []entry.LogMetadata
+	metadataOffset int64
+}
+
+func (b *rebuilder) scan(id int, path string, indexWriter, metadataWriter *rebuildWriter) error {
+	seg, err := segment.NewReadOnlySegment(id, path)
+	if err != nil {
+		return fmt.Errorf("failed to open segment %d. %w", id, err)
+	}
+	defer seg.Close()
+
+	if seg.Version() == segment.LegacyVersion {
+		return fmt.Errorf("can not rebuild from legacy segment %d", id)
+	}
+
+	scanner := seg.Scanner()
+	for scanner.Next() {
+		log := scanner.Log()
+		if !crc.IsMatch(log.PayLoad, log.CRC) {
+			b.torn = scanner.Offset()+seg.LogSize(len(log.PayLoad)) >= int64(seg.Size())
+			return fmt.Errorf("crc of log %d is mismatched on segment %d at %d", log.Index, id, scanner.Offset())
+		}
+
+		switch {
+		case log.IsFirstFragment():
+			if b.pending {
+				return fmt.Errorf("log %d is not completed before log %d", b.pendingIndex, log.Index)
+			}
+			if b.assembled >= 0 && log.Index != b.assembled+1 {
+				return fmt.Errorf("log %d is not continuous with log %d", log.Index, b.assembled)
+			}
+			b.pending = true
+			b.pendingIndex = log.Index
+			b.logs = b.logs[:0]
+			b.fragments = nil
+		case !b.pending && b.assembled < 0:
+			// tail fragments of log whose head is not on segments
+			continue
+		case !b.pending || log.Index != b.pendingIndex || log.Sequence != len(b.logs):
+			return fmt.Errorf("unexpected fragment %d of log %d", log.Sequence, log.Index)
+		}
+
+		b.logs = append(b.logs, entry.LogMetadata{
+			SegmentID: id,
+			Size:      len(log.PayLoad),
+			Sequence:  log.Sequence,
+			CRC:       log.CRC,
+			Offset:    scanner.Offset(),
+		})
+
+		// payload is copied since scanner reuses its buffer
+		if b.chained {
+			b.fragments = append(b.fragments, append([]byte(nil), log.PayLoad...))
+		}
+
+		if log.IsLastFragment() {
+			if err := b.assemble(log.IsBatchContinued(), indexWriter, metadataWriter); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		b.torn = errors.Is(err, segment.ErrPartialLog)
+		return fmt.Errorf("failed to scan segment %d. %w", id, err)
+	}
+	return nil
+}
+
+// assemble completes reassembling log. logs of batch are written when the last log of batch is assembled.
+func (b *rebuilder) assemble(batchContinued bool, indexWriter, metadataWriter *rebuildWriter) error {
+	if b.pendingIndex >= b.compacted {
+		m := metadata.NewMetadata(b.pendingIndex, b.logs)
+		if b.chained {
+			hash, err := b.chainHash()
+			if err != nil {
+				return err
+			}
+			b.head = hash
+			m = metadata.NewHashedMetadata(b.pendingIndex, b.logs, b.head)
+		}
+		b.batch = append(b.batch, m)
+	}
+	b.assembled = b.pendingIndex
+	b.pending = false
+	b.logs = make([]entry.LogMetadata, 0)
+
+	if batchContinued {
+		return nil
+	}
+	return b.commit(indexWriter, metadataWriter)
+}
+
+// chainHash returns hash of log being reassembled, chained from the previous log.
+// returns ChainError if it does not match with hash on old metadata.
+func (b *rebuilder) chainHash() ([]byte, error) {
+	stored := b.old.hash(b.pendingIndex)
+
+	// hash on old metadata anchors the first log, since the log before it may be removed
+	if b.head == nil && b.pendingIndex > 0 && stored != nil {
+		return stored, nil
+	}
+
+	hash := entry.ChainHash(b.head, b.pendingIndex, b.fragments...)
+	if stored != nil && !bytes.Equal(hash, stored) {
+		return nil, &ChainError{Index: b.pendingIndex, Reason: "hash does not match with old metadata"}
+	}
+	return hash, nil
+}
+
+// commit writes metadata and index of reassembled logs of batch
+func (b *rebuilder) commit(indexWriter, metadataWriter *rebuildWriter) error {
+	for _, m := range b.batch {
+		if err := metadataWriter.write(metadata.EncodeMetadata(m)); err != nil {
+			return err
+		}
+
+		// index file starts with header of the first rebuilt log
+		if b.lastIndex < 0 {
+			if err := indexWriter.write(index.EncodeHeader(m.Index)); err != nil {
+				return err
+			}
+		}
+
+		i := index.NewIndex(m.Index, b.metadataOffset, m.Size)
+		if err := indexWriter.write(index.EncodeIndex(i)); err != nil {
+			return err
+		}
+
+		if b.lastIndex < 0 {
+			b.firstIndex = m.Index
+		}
+		b.lastIndex = m.Index
+		b.metadataOffset += int64(m.Size)
+	}
+
+	b.batch = b.batch[:0]
+	return nil
+}
+
+// rebuildWriter writes rebuilt file on temporary path with buffering
+type rebuildWriter struct {
+	file file.File
+	path string
+	buf  []byte
+}
+
+func newRebuildWriter(path string) (*rebuildWriter, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale file. %w", err)
+	}
+
+	f := file.NewFile()
+	if err := f.Open(path); err != nil {
+		return nil, fmt.Errorf("failed to open file. %w", err)
+	}
+
+	return &rebuildWriter{
+		file: f,
+		path: path,
+		buf:  make([]byte, 0, rebuildFlushByteSize),
+	}, nil
+}
+
+func (w *rebuildWriter) write(data []byte) error {
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < rebuildFlushByteSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *rebuildWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	if err := w.file.Write(w.buf); err != nil {
+		return fmt.Errorf("failed to write file. %w", err)
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// commit flushes and syncs temporary file, and replaces file on path with it
+func (w *rebuildWriter) commit(path string) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file. %w", err)
+	}
+
+	return file.Replace(w.path, path)
+}
+
+// close closes temporary file and removes it if it was not committed
+func (w *rebuildWriter) close() {
+	w.file.Close()
+	os.Remove(w.path)
+}
@@ -0,0 +1,343 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 64,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := [][]byte{
+		[]byte("test data1"),
+		bytes.Repeat([]byte("a"), 100),
+		{},
+		[]byte("test data2"),
+	}
+	for _, data := range expected {
+		if _, err := storage.Write(data); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// lose index and damage metadata
+	if err := os.Remove(path + "/index"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.WriteFile(path+"/metadata", []byte("broken"), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report, err := Rebuild(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if report.Err != nil {
+		t.Fatalf("expected no error, got %v", report.Err)
+	}
+	if report.FirstIndex != 0 || report.LastIndex != int64(len(expected)-1) {
+		t.Errorf("expected logs from 0 to %d, got %d to %d", len(expected)-1, report.FirstIndex, report.LastIndex)
+	}
+
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if storage.Recovery().Repaired() {
+		t.Errorf("expected no repair after rebuild, got %+v", storage.Recovery())
+	}
+
+	for i, data := range expected {
+		readData, err := storage.Read(int64(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Equal(readData, data) {
+			t.Errorf("expected data to be %s, got %s", data, readData)
+		}
+	}
+}
+
+func TestRebuild_TornSegment(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, data := range []string{"test data1", "test data2"} {
+		if _, err := storage.Write([]byte(data)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := os.Stat(path + "/segment_0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.Truncate(path+"/segment_0", info.Size()-1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report, err := Rebuild(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if report.Err == nil {
+		t.Errorf("expected torn log to be reported")
+	}
+	if report.LastIndex != 0 {
+		t.Errorf("expected last index to be 0, got %d", report.LastIndex)
+	}
+
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if storage.LastIndex() != 0 {
+		t.Errorf("expected last index to be 0, got %d", storage.LastIndex())
+	}
+
+	readData, err := storage.Read(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "test data1" {
+		t.Errorf("expected data to be 'test data1', got %s", string(readData))
+	}
+}
+
+func TestRebuild_TornBatch(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := storage.Write([]byte("test data0")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, err := storage.WriteBatch([][]byte{[]byte("test data1"), []byte("test data2")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// tear the last log of batch
+	info, err := os.Stat(path + "/segment_0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.Truncate(path+"/segment_0", info.Size()-1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report, err := Rebuild(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if report.Err == nil {
+		t.Errorf("expected torn batch to be reported")
+	}
+	if report.LastIndex != 0 {
+		t.Errorf("expected whole batch to be discarded, got last index %d", report.LastIndex)
+	}
+}
+
+func TestRebuild_BrokenLog(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, data := range []string{"test data0", "test data1", "test data2"} {
+		if _, err := storage.Write([]byte(data)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// flip payload of log in the middle of segment
+	segmentData, err := os.ReadFile(path + "/segment_0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	segmentData[bytes.Index(segmentData, []byte("test data1"))] ^= 0xff
+	if err := os.WriteFile(path+"/segment_0", segmentData, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	saved := make(map[string][]byte)
+	for _, name := range []string{"index", "metadata"} {
+		data, err := os.ReadFile(path + "/" + name)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		saved[name] = data
+	}
+
+	report, err := Rebuild(path)
+	if !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected %v, got %v", ErrCorrupted, err)
+	}
+	if report.Err == nil {
+		t.Errorf("expected broken log to be reported")
+	}
+
+	// old files are kept
+	for name, data := range saved {
+		current, err := os.ReadFile(path + "/" + name)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Equal(current, data) {
+			t.Errorf("expected %s not to be replaced", name)
+		}
+	}
+
+	report, err = ForceRebuild(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if report.LastIndex != 0 {
+		t.Errorf("expected last index to be 0, got %d", report.LastIndex)
+	}
+}
+
+func TestRebuild_Interrupted(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := writeTestLogs(t, storage, 10)
+	if err := storage.TruncateFront(3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	oldIndex, err := os.ReadFile(path + "/index")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := Rebuild(path); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// crash after metadata is replaced and before index is replaced
+	if err := os.WriteFile(path+"/index", oldIndex, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := os.WriteFile(path+"/"+RebuildMarkerFileName, nil, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		if _, err := NewStorage(Options{Path: path, ReadOnly: true}); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("expected %v, got %v", ErrCorrupted, err)
+		}
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if report := storage.Recovery(); !report.Rebuilt || report.DiscardedLogs != 0 || report.TruncatedSegmentBytes != 0 {
+			t.Errorf("expected files to be rebuilt again without discarding logs, got %+v", report)
+		}
+		if _, err := os.Stat(path + "/" + RebuildMarkerFileName); !os.IsNotExist(err) {
+			t.Errorf("expected marker to be removed, got %v", err)
+		}
+		if storage.FirstIndex() != 3 || storage.LastIndex() != 9 {
+			t.Fatalf("expected logs 3 - 9, got %d - %d", storage.FirstIndex(), storage.LastIndex())
+		}
+
+		for i := int64(3); i <= 9; i++ {
+			data, err := storage.Read(i)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !bytes.Equal(data, expected[i]) {
+				t.Errorf("expected %s, got %s", expected[i], data)
+			}
+		}
+	})
+}
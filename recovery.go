@@ -0,0 +1,422 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/crc"
+	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+// RecoveryReport describes what was discarded from the tail of storage
+// to return to the last fully committed log when storage was opened.
+type RecoveryReport struct {
+	// LastIndex is the index of the last committed log after recovery.
+	LastIndex int64
+
+	// DiscardedLogs is the number of logs on the index file discarded
+	// because their metadata or segment data was not fully written.
+	DiscardedLogs int
+
+	// TruncatedIndexBytes is the number of bytes truncated from the index file.
+	TruncatedIndexBytes int64
+
+	// TruncatedMetadataBytes is the number of bytes truncated from the metadata file.
+	TruncatedMetadataBytes int64
+
+	// TruncatedSegmentBytes is the number of bytes truncated from segment files.
+	TruncatedSegmentBytes int64
+
+	// RemovedSegments is ids of segment files removed because they only had uncommitted logs.
+	RemovedSegments []int
+
+	// Rebuilt reports whether index and metadata files were rebuilt from segments
+	// because rebuilding them was interrupted.
+	Rebuilt bool
+}
+
+// Repaired reports whether anything was discarded or rebuilt while recovery
+func (r RecoveryReport) Repaired() bool {
+	return r.DiscardedLogs > 0 ||
+		r.TruncatedIndexBytes > 0 ||
+		r.TruncatedMetadataBytes > 0 ||
+		r.TruncatedSegmentBytes > 0 ||
+		len(r.RemovedSegments) > 0 ||
+		r.Rebuilt
+}
+
+// recover validates tail of index, metadata and segment files against each other
+// and truncates inconsistent tail back to the last fully committed log.
+// storage write order is segment -> metadata -> index, so index file is the commit point,
+// and only logs of the last unfinished batch and segment bytes not fully framed are discarded.
+// if segments have more completed batches after the last valid log, index or metadata disagree with segments
+// beyond the torn tail. files are not changed then, and storage should be rebuilt from segments.
+func (s *storage) recover() (RecoveryReport, error) {
+	// files replaced by interrupted rebuild do not match with each other
+	rebuilt := false
+	if rebuildInterrupted(s.options.Path) {
+		if err := s.rebuildFiles(); err != nil {
+			return RecoveryReport{}, err
+		}
+		rebuilt = true
+	}
+
+	report := RecoveryReport{
+		RemovedSegments: make([]int, 0),
+		Rebuilt:         rebuilt,
+	}
+
+	// remove partial index record on the tail of index file
+	indexFileSize, err := s.indexFile.Size()
+	if err != nil {
+		return report, fmt.Errorf("failed to get index file size. %w", err)
+	}
+
+	lastIndex := s.indexFile.LastIndex()
+	if err := s.indexFile.TruncateBack(lastIndex); err != nil {
+		return report, fmt.Errorf("failed to truncate index file. %w", err)
+	}
+
+	segmentIDs, err := segment.List(s.options.Path)
+	if err != nil {
+		return report, fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	segmentSizes, err := s.segmentSizes(segmentIDs)
+	if err != nil {
+		return report, err
+	}
+
+	// walk back from the last index until finding fully committed log.
+	// logs of batch whose last log is not committed are discarded together.
+	discarded := 0
+	for ; lastIndex >= s.indexFile.FirstIndex(); lastIndex-- {
+		valid, batchContinued := s.validateLog(lastIndex, segmentSizes)
+		if valid && !batchContinued {
+			break
+		}
+		discarded++
+	}
+
+	// only the last batch can be written on segments without its index when crashed
+	segmentID, segmentEnd, err := s.lastSegmentPosition(lastIndex)
+	if err != nil {
+		return report, err
+	}
+
+	batches, err := s.unindexedBatches(lastIndex, segmentIDs, segmentID, segmentEnd)
+	if err != nil {
+		return report, err
+	}
+	if batches > 1 {
+		err := fmt.Errorf("%w. segments have %d batches after log %d which are not on index. rebuild storage from segments", ErrCorrupted, batches, lastIndex)
+		return report, newError("recover", s.options.Path, err)
+	}
+
+	report.DiscardedLogs = discarded
+	if err := s.indexFile.TruncateBack(lastIndex); err != nil {
+		return report, fmt.Errorf("failed to truncate index file. %w", err)
+	}
+
+	truncatedIndexFileSize, err := s.indexFile.Size()
+	if err != nil {
+		return report, fmt.Errorf("failed to get index file size. %w", err)
+	}
+	report.TruncatedIndexBytes = indexFileSize - truncatedIndexFileSize
+
+	if err := s.discardTail(lastIndex, segmentIDs, segmentSizes, &report); err != nil {
+		return report, err
+	}
+
+	report.LastIndex = lastIndex
+	return report, nil
+}
+
+// unindexedBatches scans segments from offset of segment id,
+// and returns number of batches completed by logs after lastIndex.
+func (s *storage) unindexedBatches(lastIndex int64, segmentIDs []int, segmentID int, offset int64) (int, error) {
+	batches := 0
+	for _, id := range segmentIDs {
+		if id < segmentID {
+			continue
+		}
+
+		seg, err := segment.NewReadOnlySegment(id, s.options.Path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open segment. %w", err)
+		}
+
+		// legacy segment is not self describing, and is validated only against index
+		if seg.Version() != segment.LegacyVersion {
+			start := int64(0)
+			if id == segmentID {
+				start = offset
+			}
+			batches += completedBatches(seg.ScannerAt(start), lastIndex)
+		}
+
+		if err := seg.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return batches, nil
+}
+
+// completedBatches returns number of logs after lastIndex on scanner which complete their batch.
+// scanning stops at bytes not fully framed, which are left by crash while writing.
+func completedBatches(scanner *segment.Scanner, lastIndex int64) int {
+	batches := 0
+	for scanner.Next() {
+		log := scanner.Log()
+		if log.Index <= lastIndex || !crc.IsMatch(log.PayLoad, log.CRC) {
+			continue
+		}
+
+		if log.IsLastFragment() && !log.IsBatchContinued() {
+			batches++
+		}
+	}
+	return batches
+}
+
+// rebuildFiles replaces index and metadata files with files rebuilt from segments
+func (s *storage) rebuildFiles() error {
+	if err := s.indexFile.Close(); err != nil {
+		return err
+	}
+
+	if err := s.metadataFile.Close(); err != nil {
+		return err
+	}
+
+	if _, err := rebuild(s.options.Path, s.options.HashChain, false); err != nil {
+		return fmt.Errorf("failed to rebuild storage. %w", err)
+	}
+
+	if err := s.indexFile.Open(); err != nil {
+		return fmt.Errorf("failed to open index file. %w", err)
+	}
+
+	if err := s.metadataFile.Open(); err != nil {
+		return fmt.Errorf("failed to open metadata file. %w", err)
+	}
+	return nil
+}
+
+// discardTail removes metadata and segment data written after log of lastIndex
+func (s *storage) discardTail(lastIndex int64, segmentIDs []int, segmentSizes map[int]int64, report *RecoveryReport) error {
+	if err := s.discardMetadata(lastIndex, report); err != nil {
+		return err
+	}
+	return s.discardSegments(lastIndex, segmentIDs, segmentSizes, report)
+}
+
+// discardMetadata removes metadata not referenced by index after log of lastIndex
+func (s *storage) discardMetadata(lastIndex int64, report *RecoveryReport) error {
+	metadataEnd := s.metadataFile.BaseOffset()
+	if lastIndex >= s.indexFile.FirstIndex() {
+		index, err := s.indexFile.Read(lastIndex)
+		if err != nil {
+			return fmt.Errorf("failed to read index. %w", err)
+		}
+		metadataEnd = index.MetadataOffset + int64(index.MetadataSize)
+	}
+
+	if metadataFileSize := s.metadataFile.LastOffset(); metadataFileSize > metadataEnd {
+		if err := s.metadataFile.Truncate(metadataEnd); err != nil {
+			return err
+		}
+		report.TruncatedMetadataBytes = metadataFileSize - metadataEnd
+	}
+	return nil
+}
+
+// discardSegments removes segment data written after log of lastIndex.
+// segments created after the segment of the last log are removed unless they are empty.
+func (s *storage) discardSegments(lastIndex int64, segmentIDs []int, segmentSizes map[int]int64, report *RecoveryReport) error {
+	segmentID, segmentEnd, err := s.lastSegmentPosition(lastIndex)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range segmentIDs {
+		size := segmentSizes[id]
+		switch {
+		case id > segmentID:
+			// segment created by rolling after the last log has no log to discard
+			empty, err := s.segmentEmpty(id)
+			if err != nil {
+				return err
+			}
+			if empty {
+				continue
+			}
+
+			if err := s.removeSegment(id); err != nil {
+				return err
+			}
+			report.RemovedSegments = append(report.RemovedSegments, id)
+			report.TruncatedSegmentBytes += size
+		case id == segmentID && size > segmentEnd:
+			truncated, err := s.truncateSegment(id, segmentEnd)
+			if err != nil {
+				return err
+			}
+			report.TruncatedSegmentBytes += truncated
+		}
+	}
+
+	return nil
+}
+
+// validateLog checks log of index i is fully written on index, metadata and segment files.
+// also reports whether log is followed by another log of the same batch.
+func (s *storage) validateLog(i int64, segmentSizes map[int]int64) (bool, bool) {
+	index, err := s.indexFile.Read(i)
+	if err != nil || index.Index != i {
+		return false, false
+	}
+
+	if index.MetadataOffset+int64(index.MetadataSize) > s.metadataFile.LastOffset() {
+		return false, false
+	}
+
+	m, err := s.metadataFile.Read(index.MetadataOffset, index.MetadataSize)
+	if err != nil || m.Index != i || m.Size != index.MetadataSize {
+		return false, false
+	}
+
+	batchContinued := false
+	for _, logMetadata := range m.LogMetadata {
+		log, valid := s.validateLogOnSegment(logMetadata, segmentSizes)
+		if !valid {
+			return false, false
+		}
+		batchContinued = batchContinued || log.IsBatchContinued()
+	}
+
+	return true, batchContinued
+}
+
+// validateLogOnSegment checks log is fully written on segment and matched with crc
+func (s *storage) validateLogOnSegment(m entry.LogMetadata, segmentSizes map[int]int64) (entry.Log, bool) {
+	size, exist := segmentSizes[m.SegmentID]
+	if !exist {
+		return entry.Log{}, false
+	}
+
+	seg, err := segment.NewSegment(m.SegmentID, s.options.Path)
+	if err != nil {
+		return entry.Log{}, false
+	}
+	defer seg.Close()
+
+	if m.Offset+seg.LogSize(m.Size) > size {
+		return entry.Log{}, false
+	}
+
+	log, err := seg.Read(m.Offset, m.Size)
+	if err != nil {
+		return entry.Log{}, false
+	}
+
+	return log, crc.IsMatch(log.PayLoad, m.CRC)
+}
+
+// lastSegmentPosition finds end position of the last log written on segment
+// at or before index i. returns first segment with zero position if there is no log.
+func (s *storage) lastSegmentPosition(i int64) (int, int64, error) {
+	for ; i >= s.indexFile.FirstIndex(); i-- {
+		m, err := s.readMetadataOfIndex(i)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if len(m.LogMetadata) == 0 {
+			continue
+		}
+
+		last := m.LogMetadata[len(m.LogMetadata)-1]
+		seg, err := segment.NewSegment(last.SegmentID, s.options.Path)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to open segment. %w", err)
+		}
+		defer seg.Close()
+
+		return last.SegmentID, last.Offset + seg.LogSize(last.Size), nil
+	}
+	return 0, 0, nil
+}
+
+// segmentSizes returns file size of each segment
+func (s *storage) segmentSizes(ids []int) (map[int]int64, error) {
+	sizes := make(map[int]int64)
+	for _, id := range ids {
+		seg, err := segment.NewSegment(id, s.options.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open segment. %w", err)
+		}
+
+		sizes[id] = int64(seg.Size())
+		if err := seg.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return sizes, nil
+}
+
+// segmentEmpty reports whether segment of id has no log
+func (s *storage) segmentEmpty(id int) (bool, error) {
+	seg, err := segment.NewSegment(id, s.options.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open segment. %w", err)
+	}
+	defer seg.Close()
+
+	return seg.Empty(), nil
+}
+
+// truncateSegment truncates segment file of id to size and syncs it, and returns truncated bytes
+func (s *storage) truncateSegment(id int, size int64) (int64, error) {
+	s.segments.remove(id)
+
+	seg, err := segment.NewSegment(id, s.options.Path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open segment. %w", err)
+	}
+	defer seg.Close()
+
+	before := seg.Size()
+	if err := seg.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	if err := seg.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync segment. %w", err)
+	}
+	return int64(before - seg.Size()), nil
+}
@@ -0,0 +1,408 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// crashSnapshot holds contents of storage files and size of each file after every write
+type crashSnapshot struct {
+	files map[string][]byte
+	sizes []map[string]int64
+	data  [][]byte
+}
+
+func writeCrashSnapshot(t *testing.T, path string, options Options, count int) crashSnapshot {
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	snapshot := crashSnapshot{
+		files: make(map[string][]byte),
+		sizes: []map[string]int64{fileSizesOnDir(t, path)},
+		data:  make([][]byte, 0),
+	}
+
+	for i := 0; i < count; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i)}, 5+i*3)
+		if _, err := storage.Write(data); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		snapshot.data = append(snapshot.data, data)
+		snapshot.sizes = append(snapshot.sizes, fileSizesOnDir(t, path))
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for name := range snapshot.sizes[count] {
+		buf, err := os.ReadFile(filepath.Join(path, name))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		snapshot.files[name] = buf
+	}
+	return snapshot
+}
+
+func fileSizesOnDir(t *testing.T, path string) map[string]int64 {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sizes := make(map[string]int64)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		sizes[e.Name()] = info.Size()
+	}
+	return sizes
+}
+
+// crashOrder returns files in the order storage writes them
+func crashOrder(sizes map[string]int64) []string {
+	names := make([]string, 0)
+	for name := range sizes {
+		if name != "index" && name != "metadata" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		var a, b int
+		fmt.Sscanf(names[i], "segment_%d", &a)
+		fmt.Sscanf(names[j], "segment_%d", &b)
+		return a < b
+	})
+	return append(names, "metadata", "index")
+}
+
+func restoreCrashSnapshot(t *testing.T, path string, snapshot crashSnapshot, sizes map[string]int64) {
+	createTempDir(path)
+	for name, size := range sizes {
+		if err := os.WriteFile(filepath.Join(path, name), snapshot.files[name][:size], 0644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
+
+// verifyCorruptedStorage checks storage fails to open without changing segments,
+// and every log is recovered by rebuilding storage
+func verifyCorruptedStorage(t *testing.T, options Options, snapshot crashSnapshot, sizes map[string]int64) {
+	_, err := NewStorage(options)
+	if !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+
+	for name, size := range fileSizesOnDir(t, options.Path) {
+		if name != "index" && name != "metadata" && size != sizes[name] {
+			t.Fatalf("expected %s not to be changed, got size %d", name, size)
+		}
+	}
+
+	if _, err := Rebuild(options.Path); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	verifyRecoveredStorage(t, options, snapshot, int64(len(snapshot.data)-1))
+}
+
+func verifyRecoveredStorage(t *testing.T, options Options, snapshot crashSnapshot, expectedLastIndex int64) {
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if storage.LastIndex() != expectedLastIndex {
+		t.Fatalf("expected last index to be %d, got %d", expectedLastIndex, storage.LastIndex())
+	}
+
+	for i := int64(0); i <= expectedLastIndex; i++ {
+		readData, err := storage.Read(i)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Equal(readData, snapshot.data[i]) {
+			t.Fatalf("expected data to be %s, got %s", snapshot.data[i], readData)
+		}
+	}
+
+	// storage must keep appending right after the recovered log
+	data := []byte("after recovery")
+	index, err := storage.Write(data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if index != expectedLastIndex+1 {
+		t.Fatalf("expected index to be %d, got %d", expectedLastIndex+1, index)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if storage.Recovery().Repaired() {
+		t.Fatalf("expected no repair after recovery, got %+v", storage.Recovery())
+	}
+
+	readData, err := storage.Read(index)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatalf("expected data to be %s, got %s", data, readData)
+	}
+}
+
+func TestStorage_Recovery(t *testing.T) {
+	t.Run("CrashOnEveryByte", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 64,
+		}
+		snapshot := writeCrashSnapshot(t, path, options, 6)
+
+		// crash at every byte while writing each log
+		for i := 1; i < len(snapshot.sizes); i++ {
+			prev, next := snapshot.sizes[i-1], snapshot.sizes[i]
+
+			written := int64(0)
+			for _, name := range crashOrder(next) {
+				written += next[name] - prev[name]
+			}
+
+			for cut := int64(0); cut < written; cut++ {
+				sizes := make(map[string]int64)
+				remained := cut
+				for _, name := range crashOrder(next) {
+					delta := next[name] - prev[name]
+					if delta > remained {
+						delta = remained
+					}
+					remained -= delta
+					if size := prev[name] + delta; size > 0 {
+						sizes[name] = size
+					}
+				}
+
+				t.Run(fmt.Sprintf("log_%d_byte_%d", i-1, cut), func(t *testing.T) {
+					restoreCrashSnapshot(t, path, snapshot, sizes)
+					verifyRecoveredStorage(t, options, snapshot, int64(i-2))
+				})
+			}
+		}
+	})
+
+	t.Run("CutIndexFile", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		snapshot := writeCrashSnapshot(t, path, options, 4)
+
+		last := snapshot.sizes[len(snapshot.sizes)-1]
+		for cut := int64(0); cut <= last["index"]; cut++ {
+			sizes := make(map[string]int64)
+			for name, size := range last {
+				sizes[name] = size
+			}
+			sizes["index"] = cut
+
+			// index file starts with 20 bytes header
+			expectedLastIndex := int64(-1)
+			if cut > 20 {
+				expectedLastIndex = (cut-20)/20 - 1
+			}
+
+			restoreCrashSnapshot(t, path, snapshot, sizes)
+
+			// only the last log can be discarded as torn tail
+			if expectedLastIndex < 2 {
+				verifyCorruptedStorage(t, options, snapshot, sizes)
+				continue
+			}
+			verifyRecoveredStorage(t, options, snapshot, expectedLastIndex)
+		}
+	})
+
+	t.Run("CutMetadataFile", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		snapshot := writeCrashSnapshot(t, path, options, 4)
+
+		last := snapshot.sizes[len(snapshot.sizes)-1]
+		for cut := int64(0); cut <= last["metadata"]; cut++ {
+			sizes := make(map[string]int64)
+			for name, size := range last {
+				sizes[name] = size
+			}
+			sizes["metadata"] = cut
+
+			expectedLastIndex := int64(-1)
+			for i := 1; i < len(snapshot.sizes); i++ {
+				if snapshot.sizes[i]["metadata"] <= cut {
+					expectedLastIndex = int64(i - 1)
+				}
+			}
+
+			restoreCrashSnapshot(t, path, snapshot, sizes)
+
+			// only the last log can be discarded as torn tail
+			if expectedLastIndex < 2 {
+				verifyCorruptedStorage(t, options, snapshot, sizes)
+				continue
+			}
+			verifyRecoveredStorage(t, options, snapshot, expectedLastIndex)
+		}
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		snapshot := writeCrashSnapshot(t, path, options, 2)
+
+		// orphaned segment bytes, metadata without index and half written index
+		last := snapshot.sizes[len(snapshot.sizes)-1]
+		sizes := make(map[string]int64)
+		for name, size := range last {
+			sizes[name] = size
+		}
+		sizes["index"] = snapshot.sizes[1]["index"] + 10
+		restoreCrashSnapshot(t, path, snapshot, sizes)
+
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		report := storage.Recovery()
+		if !report.Repaired() {
+			t.Fatalf("expected repair, got %+v", report)
+		}
+		if report.LastIndex != 0 {
+			t.Errorf("expected last index to be 0, got %d", report.LastIndex)
+		}
+		if report.TruncatedIndexBytes != 10 {
+			t.Errorf("expected 10 truncated index bytes, got %d", report.TruncatedIndexBytes)
+		}
+		if report.DiscardedLogs != 0 {
+			t.Errorf("expected 0 discarded logs, got %d", report.DiscardedLogs)
+		}
+
+		expectedMetadataBytes := last["metadata"] - snapshot.sizes[1]["metadata"]
+		if report.TruncatedMetadataBytes != expectedMetadataBytes {
+			t.Errorf("expected %d truncated metadata bytes, got %d", expectedMetadataBytes, report.TruncatedMetadataBytes)
+		}
+
+		expectedSegmentBytes := last["segment_0"] - snapshot.sizes[1]["segment_0"]
+		if report.TruncatedSegmentBytes != expectedSegmentBytes {
+			t.Errorf("expected %d truncated segment bytes, got %d", expectedSegmentBytes, report.TruncatedSegmentBytes)
+		}
+		if report.Rebuilt {
+			t.Errorf("expected torn tail not to be rebuilt, got %+v", report)
+		}
+	})
+
+	for _, name := range []string{"index", "metadata"} {
+		t.Run("Remove_"+name, func(t *testing.T) {
+			path := "./tmp"
+			createTempDir(path)
+			defer deleteAllFilesOnDir(path)
+
+			options := Options{
+				Path:            path,
+				SegmentFileSize: 256,
+			}
+			storage, err := NewStorage(options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := writeTestLogs(t, storage, 20)
+			storage.Close()
+
+			if err := os.Remove(filepath.Join(path, name)); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			// logs on segments are not discarded for lost file
+			_, err = NewStorage(options)
+			if !errors.Is(err, ErrCorrupted) {
+				t.Fatalf("expected ErrCorrupted, got %v", err)
+			}
+
+			if _, err := Rebuild(path); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			storage, err = NewStorage(options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer storage.Close()
+
+			if storage.FirstIndex() != 0 || storage.LastIndex() != 19 {
+				t.Fatalf("expected logs 0 - 19, got %d - %d", storage.FirstIndex(), storage.LastIndex())
+			}
+
+			for i := int64(0); i < 20; i++ {
+				data, err := storage.Read(i)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if !bytes.Equal(data, expected[i]) {
+					t.Fatalf("expected %s, got %s", expected[i], data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+// RetentionPolicy removes the oldest sealed segments and their logs automatically.
+// retention runs when segment is rolled, and periodically if Interval is set.
+// the active segment and logs above SafeIndex are never removed.
+type RetentionPolicy struct {
+	// MaxBytes is the maximum total size of segment files. 0 is unlimited.
+	MaxBytes int64
+
+	// MaxLogs is the maximum number of logs. 0 is unlimited.
+	MaxLogs int64
+
+	// MaxAge is the maximum age of sealed segment since its last write. 0 is unlimited.
+	MaxAge time.Duration
+
+	// Interval is the period of retention on background. 0 runs retention only when segment is rolled.
+	Interval time.Duration
+
+	// SafeIndex returns the highest index safe to remove, such as index of the last snapshotted log.
+	// logs above it are never removed. if nil, every log on sealed segments can be removed.
+	SafeIndex func() int64
+
+	// OnRemove is called after retention removes segments
+	OnRemove func(RetentionEvent)
+}
+
+// RetentionEvent describes segments and logs removed by retention
+type RetentionEvent struct {
+	// SegmentIDs is ids of removed segment files
+	SegmentIDs []int
+
+	// FirstIndex is the index of the first log after removal
+	FirstIndex int64
+
+	// RemovedLogs is the number of removed logs
+	RemovedLogs int64
+
+	// RemovedBytes is the total size of removed segment files
+	RemovedBytes int64
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxBytes > 0 || p.MaxLogs > 0 || p.MaxAge > 0
+}
+
+// retainPeriodically applies retention when segment is rolled or on every interval until storage is closed
+func (s *storage) retainPeriodically(interval time.Duration) {
+	defer close(s.retentionDone)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+		case <-s.retentionTrigger:
+		case <-s.stopRetention:
+			return
+		}
+
+		// failed retention is retried on the next trigger
+		s.retain()
+	}
+}
+
+// triggerRetention wakes background retention without blocking writer
+func (s *storage) triggerRetention() {
+	if s.retentionTrigger == nil {
+		return
+	}
+
+	select {
+	case s.retentionTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// retain removes the oldest sealed segments exceeding retention policy, and emits event of removal
+func (s *storage) retain() (RetentionEvent, error) {
+	policy := s.options.Retention
+	safeIndex := int64(-1)
+	if policy.SafeIndex != nil {
+		safeIndex = policy.SafeIndex()
+	}
+
+	s.mutex.Lock()
+	event, err := s.applyRetention(safeIndex, policy.SafeIndex != nil, time.Now())
+	s.mutex.Unlock()
+
+	if err == nil && len(event.SegmentIDs) > 0 && policy.OnRemove != nil {
+		policy.OnRemove(event)
+	}
+	return event, err
+}
+
+// applyRetention truncates front of logs to remove sealed segments exceeding retention policy
+func (s *storage) applyRetention(safeIndex int64, limited bool, now time.Time) (RetentionEvent, error) {
+	policy := s.options.Retention
+	first, last := s.indexFile.FirstIndex(), s.indexFile.LastIndex()
+
+	segmentIDs, err := segment.List(s.options.Path)
+	if err != nil {
+		return RetentionEvent{}, fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	totalBytes := int64(0)
+	sizes := make(map[int]int64)
+	modTimes := make(map[int]time.Time)
+	for _, id := range segmentIDs {
+		info, err := segment.Stat(id, s.options.Path)
+		if err != nil {
+			return RetentionEvent{}, fmt.Errorf("failed to stat segment %d. %w", id, err)
+		}
+		sizes[id] = info.Size()
+		modTimes[id] = info.ModTime()
+		totalBytes += info.Size()
+	}
+
+	// find the oldest segment to keep. the active segment is always kept.
+	keep := 0
+	for keep < len(segmentIDs) && segmentIDs[keep] < s.segment.ID() {
+		id := segmentIDs[keep]
+		exceeded := policy.MaxBytes > 0 && totalBytes > policy.MaxBytes ||
+			policy.MaxLogs > 0 && last-first+1 > policy.MaxLogs ||
+			policy.MaxAge > 0 && now.Sub(modTimes[id]) > policy.MaxAge
+		if !exceeded {
+			break
+		}
+
+		// logs starting on removed segment are removed together
+		next, err := s.firstIndexOfSegment(id + 1)
+		if err != nil {
+			return RetentionEvent{}, err
+		}
+
+		totalBytes -= sizes[id]
+		first = next
+		keep++
+	}
+
+	if keep == 0 {
+		return RetentionEvent{}, nil
+	}
+
+	target, err := s.firstIndexOfSegment(segmentIDs[keep])
+	if err != nil {
+		return RetentionEvent{}, err
+	}
+
+	// logs above watermark and log continued on the active segment are kept
+	if limited && target > safeIndex+1 {
+		target = safeIndex + 1
+	}
+	if target > last && !s.segment.Empty() {
+		target = last
+	}
+
+	before := s.indexFile.FirstIndex()
+	if target <= before {
+		return RetentionEvent{}, nil
+	}
+
+	if err := s.truncateFront(target); err != nil {
+		return RetentionEvent{}, err
+	}
+
+	event := RetentionEvent{
+		SegmentIDs:  make([]int, 0),
+		FirstIndex:  s.indexFile.FirstIndex(),
+		RemovedLogs: s.indexFile.FirstIndex() - before,
+	}
+	for _, id := range segmentIDs {
+		if _, err := segment.Stat(id, s.options.Path); err == nil {
+			continue
+		}
+		event.SegmentIDs = append(event.SegmentIDs, id)
+		event.RemovedBytes += sizes[id]
+	}
+	return event, nil
+}
+
+// firstIndexOfSegment returns index of the first log starting on segment of id or later.
+// returns LastIndex + 1 if there is no such log.
+func (s *storage) firstIndexOfSegment(id int) (int64, error) {
+	lo, hi := s.indexFile.FirstIndex(), s.indexFile.LastIndex()+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		m, err := s.readMetadataOfIndex(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(m.LogMetadata) > 0 && m.LogMetadata[0].SegmentID >= id {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,206 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+func segmentBytes(t *testing.T, path string) int64 {
+	segmentIDs, err := segment.List(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	total := int64(0)
+	for _, id := range segmentIDs {
+		info, err := segment.Stat(id, path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+func TestStorage_Retention(t *testing.T) {
+	setup := func(t *testing.T, path string, retention RetentionPolicy) (*storage, [][]byte) {
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 128,
+		}
+		st, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := writeTestLogs(t, st, 30)
+
+		// retention is applied by test instead of background
+		s := st.(*storage)
+		s.options.Retention = retention
+		return s, expected
+	}
+
+	verify := func(t *testing.T, s *storage, expected [][]byte) {
+		if _, err := segment.Stat(s.segment.ID(), s.options.Path); err != nil {
+			t.Errorf("expected active segment to be kept, got %v", err)
+		}
+
+		for i := s.FirstIndex(); i <= s.LastIndex(); i++ {
+			data, err := s.Read(i)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(data) != string(expected[i]) {
+				t.Errorf("expected log %d to be %s, got %s", i, expected[i], data)
+			}
+		}
+	}
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		s, expected := setup(t, path, RetentionPolicy{MaxBytes: 512})
+		defer s.Close()
+
+		event, err := s.retain()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(event.SegmentIDs) == 0 || event.FirstIndex != s.FirstIndex() {
+			t.Errorf("expected segments to be removed, got %+v", event)
+		}
+		if total := segmentBytes(t, path); total > 512 {
+			t.Errorf("expected segments to be at most 512 bytes, got %d", total)
+		}
+		verify(t, s, expected)
+	})
+
+	t.Run("MaxLogs", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		s, expected := setup(t, path, RetentionPolicy{MaxLogs: 10})
+		defer s.Close()
+
+		if _, err := s.retain(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if logs := s.LastIndex() - s.FirstIndex() + 1; logs > 10 || logs < 5 {
+			t.Errorf("expected about 10 logs, got %d", logs)
+		}
+		verify(t, s, expected)
+	})
+
+	t.Run("MaxAge", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		s, expected := setup(t, path, RetentionPolicy{MaxAge: time.Hour})
+		defer s.Close()
+
+		event, err := s.applyRetention(-1, false, time.Now())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(event.SegmentIDs) != 0 {
+			t.Errorf("expected no segment to be removed, got %+v", event)
+		}
+
+		event, err = s.applyRetention(-1, false, time.Now().Add(2*time.Hour))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		segmentIDs, err := segment.List(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(segmentIDs) != 1 || segmentIDs[0] != s.segment.ID() {
+			t.Errorf("expected only active segment to be kept, got %v, %+v", segmentIDs, event)
+		}
+		verify(t, s, expected)
+	})
+
+	t.Run("SafeIndex", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		s, expected := setup(t, path, RetentionPolicy{
+			MaxLogs:   1,
+			SafeIndex: func() int64 { return 5 },
+		})
+		defer s.Close()
+
+		if _, err := s.retain(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if s.FirstIndex() > 6 || s.FirstIndex() == 0 {
+			t.Errorf("expected logs up to 5 to be removed at most, got first index %d", s.FirstIndex())
+		}
+		verify(t, s, expected)
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		events := make(chan RetentionEvent, 100)
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 128,
+			Retention: RetentionPolicy{
+				MaxLogs:  4,
+				OnRemove: func(e RetentionEvent) { events <- e },
+			},
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		writeTestLogs(t, storage, 30)
+
+		select {
+		case event := <-events:
+			if len(event.SegmentIDs) == 0 || event.RemovedLogs == 0 || event.RemovedBytes == 0 {
+				t.Errorf("expected removed segments and logs, got %+v", event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected retention event")
+		}
+	})
+}
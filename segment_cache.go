@@ -0,0 +1,149 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+// cachedSegment is read only segment handle shared by readers
+type cachedSegment struct {
+	*segment.Segment
+
+	// refs is the number of readers using segment. evicted segment is closed when refs becomes 0.
+	refs    int
+	evicted bool
+}
+
+// segmentCache keeps read only handles of sealed segments up to capacity.
+// the least recently used handle is closed when cache is full. handles are mapped on memory if mmap is set.
+type segmentCache struct {
+	path     string
+	capacity int
+	mmap     bool
+
+	mutex   sync.Mutex
+	entries map[int]*list.Element
+	lru     *list.List
+}
+
+func newSegmentCache(path string, capacity int, mmap bool) *segmentCache {
+	return &segmentCache{
+		path:     path,
+		capacity: capacity,
+		mmap:     mmap,
+		entries:  make(map[int]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// get returns handle of segment of id. handle must be released after use.
+func (c *segmentCache) get(id int) (*cachedSegment, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, exist := c.entries[id]; exist {
+		c.lru.MoveToFront(e)
+		seg := e.Value.(*cachedSegment)
+		seg.refs++
+		return seg, nil
+	}
+
+	open := segment.NewReadOnlySegment
+	if c.mmap {
+		open = segment.NewMappedSegment
+	}
+
+	s, err := open(id, c.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment. %w", err)
+	}
+
+	seg := &cachedSegment{Segment: s, refs: 1}
+	c.entries[id] = c.lru.PushFront(seg)
+
+	for c.lru.Len() > c.capacity {
+		c.evict(c.lru.Back())
+	}
+	return seg, nil
+}
+
+// release returns handle to cache, and closes it if it was evicted while used
+func (c *segmentCache) release(seg *cachedSegment) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	seg.refs--
+	if seg.evicted && seg.refs == 0 {
+		seg.Close()
+	}
+}
+
+// remove closes handle of segment of id, which is removed or truncated
+func (c *segmentCache) remove(id int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, exist := c.entries[id]; exist {
+		c.evict(e)
+	}
+}
+
+// len returns the number of cached handles
+func (c *segmentCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// close closes every handle. handles still used are closed when released.
+func (c *segmentCache) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	errs := make([]error, 0)
+	for c.lru.Len() > 0 {
+		if err := c.evict(c.lru.Back()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *segmentCache) evict(e *list.Element) error {
+	seg := c.lru.Remove(e).(*cachedSegment)
+	delete(c.entries, seg.ID())
+
+	seg.evicted = true
+	if seg.refs > 0 {
+		return nil
+	}
+	return seg.Close()
+}
@@ -0,0 +1,147 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSegmentCache(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+	}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, storage, 10)
+	storage.Close()
+
+	cache := newSegmentCache(path, 2, false)
+	defer cache.close()
+
+	seg0, err := cache.get(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	seg1, err := cache.get(1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cache.release(seg1)
+
+	// segment 0 is the least recently used, but still used by reader
+	seg2, err := cache.get(2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cache.release(seg2)
+
+	if cache.len() != 2 {
+		t.Errorf("expected 2 cached segments, got %d", cache.len())
+	}
+	if !seg0.evicted {
+		t.Errorf("expected segment 0 to be evicted")
+	}
+	if scanner := seg0.Scanner(); !scanner.Next() {
+		t.Errorf("expected evicted segment to be readable until released, got %v", scanner.Err())
+	}
+	cache.release(seg0)
+
+	// cached handle is shared
+	again, err := cache.get(2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if again != seg2 {
+		t.Errorf("expected cached handle of segment 2")
+	}
+	cache.release(again)
+
+	cache.remove(2)
+	if cache.len() != 1 {
+		t.Errorf("expected 1 cached segment, got %d", cache.len())
+	}
+}
+
+func TestStorage_MaxOpenSegments(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("can not count opened files")
+		}
+		return len(entries)
+	}
+
+	options := Options{
+		Path:            path,
+		SegmentFileSize: 128,
+		MaxOpenSegments: 2,
+	}
+	st, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	s := st.(*storage)
+
+	expected := writeTestLogs(t, s, 30)
+	before := openFiles()
+
+	for round := 0; round < 3; round++ {
+		for i, data := range expected {
+			readData, err := s.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(readData) != string(data) {
+				t.Errorf("expected log %d to be %s, got %s", i, data, readData)
+			}
+		}
+	}
+
+	if s.segments.len() > 2 {
+		t.Errorf("expected at most 2 cached segments, got %d", s.segments.len())
+	}
+	if opened := openFiles() - before; opened > 2 {
+		t.Errorf("expected at most 2 more opened files, got %d", opened)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if s.segments.len() != 0 {
+		t.Errorf("expected cached segments to be closed, got %d", s.segments.len())
+	}
+}
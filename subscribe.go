@@ -0,0 +1,173 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// Entry is log delivered to subscriber
+type Entry struct {
+	Index int64
+	Data  []byte
+}
+
+// WaitFor blocks until log of index i is committed, ctx is done or storage is closed.
+// returns nil immediately if log of i is already committed.
+func (s *storage) WaitFor(ctx context.Context, i int64) error {
+	for {
+		s.mutex.RLock()
+		last := s.indexFile.LastIndex()
+		committed := s.committed
+		err := s.checkClosed("wait")
+		s.mutex.RUnlock()
+
+		if err != nil {
+			return err
+		}
+
+		if i <= last {
+			return nil
+		}
+
+		select {
+		case <-committed:
+		case <-s.closed:
+			return newError("wait", s.options.Path, ErrClosed).WithIndex(i)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// subscription is stopped by TruncateBack which removes logs delivered to it
+type subscription struct {
+	// next is the index of log after logs delivered
+	next   atomic.Int64
+	cancel context.CancelCauseFunc
+}
+
+// Subscribe delivers logs from index of from, and logs committed after that, on returned channel.
+// logs are read from disk by iterator, so slow subscriber only falls behind and never blocks writers.
+// cancel stops subscription and returns error which stopped it, such as ErrCompacted or ErrClosed.
+// if TruncateBack removes logs delivered, subscription is stopped with ErrTruncated,
+// since logs written again on their indexes would not be delivered.
+// channel is closed after subscription is stopped.
+func (s *storage) Subscribe(from int64) (<-chan Entry, func() error) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	entries := make(chan Entry)
+	done := make(chan struct{})
+
+	sub := &subscription{cancel: cancel}
+	sub.next.Store(from)
+
+	s.mutex.Lock()
+	s.subscriptions[sub] = struct{}{}
+	s.mutex.Unlock()
+
+	var err error
+	go func() {
+		defer close(done)
+		defer close(entries)
+		defer s.unsubscribe(sub)
+		err = s.subscribe(ctx, sub, entries)
+	}()
+
+	return entries, func() error {
+		cancel(context.Canceled)
+		<-done
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+}
+
+func (s *storage) subscribe(ctx context.Context, sub *subscription, entries chan<- Entry) error {
+	for {
+		next := sub.next.Load()
+		if err := s.WaitFor(ctx, next); err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			return err
+		}
+
+		it, err := s.NewIterator(next)
+		if err != nil {
+			return err
+		}
+
+		for it.Next() {
+			// log is counted as delivered before it is sent, since it is read before TruncateBack
+			sub.next.Store(it.Index() + 1)
+			if ctx.Err() != nil {
+				it.Close()
+				return context.Cause(ctx)
+			}
+
+			select {
+			case entries <- Entry{Index: it.Index(), Data: it.Value()}:
+			case <-s.closed:
+				it.Close()
+				return newError("subscribe", s.options.Path, ErrClosed)
+			case <-ctx.Done():
+				it.Close()
+				return context.Cause(ctx)
+			}
+		}
+
+		err = it.Err()
+		it.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *storage) unsubscribe(sub *subscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.subscriptions, sub)
+}
+
+// stopTruncatedSubscriptions stops subscriptions which were delivered logs after log of i.
+// storage must be locked for writing.
+func (s *storage) stopTruncatedSubscriptions(i int64) {
+	for sub := range s.subscriptions {
+		if i < sub.next.Load()-1 {
+			sub.cancel(newError("subscribe", s.options.Path, ErrTruncated).WithIndex(i + 1))
+		}
+	}
+}
+
+// notifyCommit wakes readers waiting for logs. storage must be locked for writing.
+func (s *storage) notifyCommit() {
+	close(s.committed)
+	s.committed = make(chan struct{})
+}
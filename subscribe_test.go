@@ -0,0 +1,238 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_WaitFor(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	writeTestLogs(t, storage, 3)
+	if err := storage.WaitFor(context.Background(), 2); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := storage.WaitFor(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// waiter wakes when log is committed
+	waited := make(chan error)
+	go func() {
+		waited <- storage.WaitFor(context.Background(), 4)
+	}()
+
+	writeTestLogs(t, storage, 1)
+	select {
+	case err := <-waited:
+		t.Fatalf("expected waiter not to wake before log 4 is committed, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	writeTestLogs(t, storage, 1)
+	if err := <-waited; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// waiter wakes when storage is closed
+	go func() {
+		waited <- storage.WaitFor(context.Background(), 10)
+	}()
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := <-waited; !errors.Is(err, ErrClosed) {
+		t.Errorf("expected error %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestStorage_Subscribe(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path, SegmentFileSize: 256})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	expected := writeTestLogs(t, storage, 10)
+	entries, cancel := storage.Subscribe(5)
+
+	// slow subscriber does not block writers
+	written := make(chan [][]byte)
+	go func() {
+		written <- writeTestLogs(t, storage, 50)
+	}()
+
+	select {
+	case logs := <-written:
+		expected = append(expected, logs...)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected writes not to be blocked by subscriber")
+	}
+
+	for i := 5; i < len(expected); i++ {
+		select {
+		case e := <-entries:
+			if e.Index != int64(i) || string(e.Data) != string(expected[i]) {
+				t.Errorf("expected log %d to be %s, got %d %s", i, expected[i], e.Index, e.Data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected log %d to be delivered", i)
+		}
+	}
+
+	if err := cancel(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := <-entries; ok {
+		t.Errorf("expected channel to be closed after canceled")
+	}
+}
+
+func TestStorage_SubscribeError(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	writeTestLogs(t, storage, 10)
+	if err := storage.TruncateFront(5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, cancel := storage.Subscribe(0)
+	for range entries {
+		t.Errorf("expected no log to be delivered")
+	}
+	if err := cancel(); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected error %v, got %v", ErrCompacted, err)
+	}
+
+	// subscription waiting for logs is stopped when storage is closed
+	entries, cancel = storage.Subscribe(10)
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for range entries {
+		t.Errorf("expected no log to be delivered")
+	}
+	if err := cancel(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected error %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestStorage_SubscribeTruncateBack(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	writeTestLogs(t, storage, 10)
+	entries, cancel := storage.Subscribe(0)
+	for i := 0; i < 10; i++ {
+		<-entries
+	}
+
+	// subscription waiting for log 10 is stopped, since logs 5 - 9 would be written again
+	if err := storage.TruncateBack(4); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, storage, 10)
+
+	for e := range entries {
+		t.Errorf("expected no log to be delivered, got log %d", e.Index)
+	}
+
+	var walErr *Error
+	if err := cancel(); !errors.Is(err, ErrTruncated) || !errors.As(err, &walErr) || walErr.Index != 5 {
+		t.Errorf("expected error %v of log 5, got %v", ErrTruncated, err)
+	}
+
+}
+
+func TestStorage_SubscribeClose(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	st, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, st, 10)
+
+	// subscriber blocked on sending log is stopped by closing storage without receiving
+	_, cancel := st.Subscribe(0)
+	if err := st.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	s := st.(*storage)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mutex.RLock()
+		subscriptions := len(s.subscriptions)
+		s.mutex.RUnlock()
+
+		if subscriptions == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected subscription to be stopped after closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := cancel(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected error %v, got %v", ErrClosed, err)
+	}
+}
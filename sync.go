@@ -0,0 +1,140 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+	"time"
+)
+
+// SyncMode decides when files of storage are synced
+type SyncMode int
+
+const (
+	// SyncAlways syncs files after every write
+	SyncAlways SyncMode = iota + 1
+
+	// SyncEveryN syncs files after every N logs are written
+	SyncEveryN
+
+	// SyncInterval syncs files periodically on background
+	SyncInterval
+
+	// SyncOnRollOnly syncs files when segment is full and new segment is rolled
+	SyncOnRollOnly
+
+	// SyncNever leaves writing back files to os. files are synced only by Sync
+	SyncNever
+)
+
+// SyncPolicy decides when segment, metadata and index files are synced
+type SyncPolicy struct {
+	Mode SyncMode
+
+	// N is the number of logs written between syncs on SyncEveryN. default is 1024.
+	N int
+
+	// Interval is the period of syncs on SyncInterval. default is 1 second.
+	Interval time.Duration
+}
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncAlways:
+		return "always"
+	case SyncEveryN:
+		return "every-n"
+	case SyncInterval:
+		return "interval"
+	case SyncOnRollOnly:
+		return "on-roll-only"
+	case SyncNever:
+		return "never"
+	}
+	return fmt.Sprintf("SyncMode(%d)", int(m))
+}
+
+// syncFiles syncs segment, metadata and index files. index file is synced last as the commit point.
+func (s *storage) syncFiles() error {
+	if err := s.segment.Sync(); err != nil {
+		return fmt.Errorf("failed to sync segment. %w", err)
+	}
+
+	if err := s.metadataFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync metadata file. %w", err)
+	}
+
+	if err := s.indexFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync index file. %w", err)
+	}
+
+	s.syncedIndex = s.indexFile.LastIndex()
+	s.unsyncedLogs = 0
+	return nil
+}
+
+// syncAfterWrite syncs files after logs are written if sync policy requires
+func (s *storage) syncAfterWrite(logs int, rolled bool) error {
+	s.unsyncedLogs += logs
+
+	policy := s.options.SyncPolicy
+	switch {
+	case policy.Mode == SyncAlways:
+	case policy.Mode == SyncEveryN && s.unsyncedLogs >= policy.N:
+	case policy.Mode == SyncOnRollOnly && rolled:
+	default:
+		return nil
+	}
+	return s.syncFiles()
+}
+
+// syncPeriodically syncs files written since the last sync on every interval until storage is closed
+func (s *storage) syncPeriodically(interval time.Duration) {
+	defer close(s.syncDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.syncedIndex < s.indexFile.LastIndex() {
+				// failed sync is retried on the next tick
+				s.syncFiles()
+			}
+			s.mutex.Unlock()
+		case <-s.stopSync:
+			return
+		}
+	}
+}
+
+// SyncedIndex returns index of the last log durably synced on disk. returns -1 if no log is synced
+func (s *storage) SyncedIndex() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.syncedIndex
+}
@@ -0,0 +1,156 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStorage_SyncPolicy(t *testing.T) {
+	writeLogs := func(t *testing.T, storage Storage, count int) {
+		for i := 0; i < count; i++ {
+			if _, err := storage.Write([]byte("test data")); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		options  Options
+		expected []int64
+	}{
+		{
+			name:     "Always",
+			options:  Options{SyncPolicy: SyncPolicy{Mode: SyncAlways}},
+			expected: []int64{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:     "SyncAfterWrite",
+			options:  Options{SyncAfterWrite: true},
+			expected: []int64{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:     "EveryN",
+			options:  Options{SyncPolicy: SyncPolicy{Mode: SyncEveryN, N: 3}},
+			expected: []int64{-1, -1, 2, 2, 2, 5},
+		},
+		{
+			// every segment holds 2 logs
+			name:     "OnRollOnly",
+			options:  Options{SegmentFileSize: 90, SyncPolicy: SyncPolicy{Mode: SyncOnRollOnly}},
+			expected: []int64{-1, 1, 1, 3, 3, 5},
+		},
+		{
+			name:     "Never",
+			options:  Options{SegmentFileSize: 90, SyncPolicy: SyncPolicy{Mode: SyncNever}},
+			expected: []int64{-1, -1, -1, -1, -1, -1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "./tmp"
+			createTempDir(path)
+			defer deleteAllFilesOnDir(path)
+
+			test.options.Path = path
+			storage, err := NewStorage(test.options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer storage.Close()
+
+			for i, expected := range test.expected {
+				writeLogs(t, storage, 1)
+				if storage.SyncedIndex() != expected {
+					t.Errorf("expected synced index to be %d after log %d, got %d", expected, i, storage.SyncedIndex())
+				}
+			}
+
+			// Sync always syncs written logs
+			if err := storage.Sync(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if storage.SyncedIndex() != storage.LastIndex() {
+				t.Errorf("expected synced index to be %d, got %d", storage.LastIndex(), storage.SyncedIndex())
+			}
+		})
+	}
+
+	t.Run("Interval", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:       path,
+			SyncPolicy: SyncPolicy{Mode: SyncInterval, Interval: 10 * time.Millisecond},
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		writeLogs(t, storage, 3)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for storage.SyncedIndex() != 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected synced index to be 2, got %d", storage.SyncedIndex())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:       path,
+			SyncPolicy: SyncPolicy{Mode: SyncNever},
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		writeLogs(t, storage, 3)
+		storage.Close()
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.SyncedIndex() != 2 {
+			t.Errorf("expected recovered logs to be synced, got synced index %d", storage.SyncedIndex())
+		}
+	})
+}
@@ -0,0 +1,235 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"fmt"
+
+	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+// TruncateFront removes all logs before index i. removed logs can not be read and Read returns ErrCompacted.
+// segment files which only have removed logs are deleted.
+func (s *storage) TruncateFront(i int64) error {
+	if s.options.ReadOnly {
+		return newError("truncate", s.options.Path, ErrReadOnly)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkClosed("truncate"); err != nil {
+		return err
+	}
+	return s.truncateFront(i)
+}
+
+func (s *storage) truncateFront(i int64) error {
+	first, last := s.indexFile.FirstIndex(), s.indexFile.LastIndex()
+	if i <= first {
+		return nil
+	}
+
+	if i > last+1 {
+		return newError("truncate", s.options.Path, ErrNotFound).WithIndex(i)
+	}
+
+	// remained logs are synced before index and metadata files are rewritten
+	if err := s.syncFiles(); err != nil {
+		return err
+	}
+
+	// every log is removed. switch to new segment to delete current segment
+	if i == last+1 && !s.segment.Empty() {
+		if err := s.rollSegment(); err != nil {
+			return fmt.Errorf("failed to roll segment. %w", err)
+		}
+	}
+
+	// index file is the commit point of truncation
+	if err := s.indexFile.TruncateFront(i); err != nil {
+		return fmt.Errorf("failed to truncate index file. %w", err)
+	}
+
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.loadHeadHash()
+}
+
+// TruncateBack removes all logs after index i. next log is written at index i + 1.
+// segments are truncated and synced first, so restart never restores removed logs from segments.
+// index and metadata after log of i are truncated after that, or by recovery on restart if crashed.
+func (s *storage) TruncateBack(i int64) error {
+	if s.options.ReadOnly {
+		return newError("truncate", s.options.Path, ErrReadOnly)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkClosed("truncate"); err != nil {
+		return err
+	}
+
+	first, last := s.indexFile.FirstIndex(), s.indexFile.LastIndex()
+	if i >= last {
+		return nil
+	}
+
+	if i < -1 {
+		return newError("truncate", s.options.Path, ErrNotFound).WithIndex(i)
+	}
+
+	if i < first-1 {
+		return newError("truncate", s.options.Path, ErrCompacted).WithIndex(i)
+	}
+
+	// log of i becomes the last log of its batch, or recovery discards it as incomplete batch
+	if i >= first {
+		if err := s.endBatch(i); err != nil {
+			return err
+		}
+	}
+
+	// segment files are reopened after truncated
+	if err := s.segment.Close(); err != nil {
+		return fmt.Errorf("failed to close segment. %w", err)
+	}
+
+	segmentIDs, err := segment.List(s.options.Path)
+	if err != nil {
+		return fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	segmentSizes, err := s.segmentSizes(segmentIDs)
+	if err != nil {
+		return err
+	}
+
+	if err := s.discardSegments(i, segmentIDs, segmentSizes, &RecoveryReport{}); err != nil {
+		return err
+	}
+
+	if err := s.openLastSegment(); err != nil {
+		return err
+	}
+
+	if err := s.indexFile.TruncateBack(i); err != nil {
+		return fmt.Errorf("failed to truncate index file. %w", err)
+	}
+	s.stopTruncatedSubscriptions(i)
+
+	if err := s.indexFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync index file. %w", err)
+	}
+
+	if err := s.discardMetadata(i, &RecoveryReport{}); err != nil {
+		return err
+	}
+
+	if err := s.loadHeadHash(); err != nil {
+		return err
+	}
+
+	if s.syncedIndex > i {
+		s.syncedIndex = i
+	}
+	return s.syncFiles()
+}
+
+// endBatch clears FlagBatchContinued on fragments of log i
+func (s *storage) endBatch(i int64) error {
+	m, err := s.readMetadataOfIndex(i)
+	if err != nil {
+		return err
+	}
+
+	for _, logMetadata := range m.LogMetadata {
+		seg, err := segment.NewReadOnlySegment(logMetadata.SegmentID, s.options.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open segment. %w", err)
+		}
+
+		log, err := seg.Read(logMetadata.Offset, logMetadata.Size)
+		seg.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read log %d. %w", i, err)
+		}
+
+		if !log.IsBatchContinued() {
+			continue
+		}
+
+		if err := segment.ClearFlags(logMetadata.SegmentID, s.options.Path, logMetadata.Offset, entry.FlagBatchContinued); err != nil {
+			return fmt.Errorf("failed to clear flags of log %d. %w", i, err)
+		}
+	}
+	return nil
+}
+
+// compact removes metadata and segments only referenced by logs before the first index.
+// it also finishes truncation interrupted by crash when storage is opened.
+func (s *storage) compact() error {
+	metadataOffset, segmentID := s.metadataFile.LastOffset(), s.segment.ID()
+	if first := s.indexFile.FirstIndex(); first <= s.indexFile.LastIndex() {
+		index, err := s.indexFile.Read(first)
+		if err != nil {
+			return fmt.Errorf("failed to read index. %w", err)
+		}
+
+		m, err := s.readMetadata(index)
+		if err != nil {
+			return fmt.Errorf("failed to read metadata. %w", err)
+		}
+
+		// log of legacy segment may have no fragment
+		metadataOffset, segmentID = index.MetadataOffset, 0
+		if len(m.LogMetadata) > 0 {
+			segmentID = m.LogMetadata[0].SegmentID
+		}
+	}
+
+	if err := s.metadataFile.TruncateFront(metadataOffset); err != nil {
+		return fmt.Errorf("failed to truncate metadata file. %w", err)
+	}
+
+	segmentIDs, err := segment.List(s.options.Path)
+	if err != nil {
+		return fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	for _, id := range segmentIDs {
+		if id >= segmentID {
+			break
+		}
+
+		if err := s.removeSegment(id); err != nil {
+			return fmt.Errorf("failed to remove segment %d. %w", id, err)
+		}
+	}
+	return nil
+}
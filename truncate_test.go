@@ -0,0 +1,422 @@
+/*
+MIT License
+
+Copyright (c) 2024 ISSuh
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ISSuh/wal/internal/index"
+	"github.com/ISSuh/wal/internal/metadata"
+	"github.com/ISSuh/wal/internal/segment"
+)
+
+func TestStorage_TruncateFront(t *testing.T) {
+	t.Run("Read", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 128,
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := writeTestLogs(t, storage, 20)
+		if err := storage.TruncateFront(10); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := storage.TruncateFront(5); err != nil {
+			t.Fatalf("expected no error on truncating removed logs, got %v", err)
+		}
+		if err := storage.TruncateFront(22); err == nil {
+			t.Fatalf("expected error on index out of range")
+		}
+
+		if _, err := storage.Read(9); !errors.Is(err, ErrCompacted) {
+			t.Errorf("expected %v, got %v", ErrCompacted, err)
+		}
+		if _, err := storage.NewIterator(0); !errors.Is(err, ErrCompacted) {
+			t.Errorf("expected %v, got %v", ErrCompacted, err)
+		}
+
+		// segments only having removed logs are deleted
+		segmentIDs, err := segment.List(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if segmentIDs[0] == 0 {
+			t.Errorf("expected segment 0 to be deleted, got %v", segmentIDs)
+		}
+
+		if _, err := storage.Write(expected[0]); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected = append(expected, expected[0])
+		storage.Close()
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.Recovery().Repaired() {
+			t.Errorf("expected no repair, got %+v", storage.Recovery())
+		}
+		if storage.FirstIndex() != 10 || storage.LastIndex() != 20 {
+			t.Errorf("expected logs from 10 to 20, got %d to %d", storage.FirstIndex(), storage.LastIndex())
+		}
+
+		it, err := storage.NewIterator(10)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer it.Close()
+
+		i := int64(10)
+		for ; it.Next(); i++ {
+			if it.Index() != i || !bytes.Equal(it.Value(), expected[i]) {
+				t.Errorf("expected log %d to be %v, got log %d %v", i, expected[i], it.Index(), it.Value())
+			}
+		}
+		if it.Err() != nil || i != 21 {
+			t.Errorf("expected to iterate to 20, got %d, %v", i-1, it.Err())
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		writeTestLogs(t, storage, 5)
+		if err := storage.TruncateFront(5); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if storage.FirstIndex() != 5 || storage.LastIndex() != 4 {
+			t.Errorf("expected empty storage from 5, got %d to %d", storage.FirstIndex(), storage.LastIndex())
+		}
+
+		segmentIDs, err := segment.List(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(segmentIDs) != 1 || segmentIDs[0] != 1 {
+			t.Errorf("expected only new segment 1 to remain, got %v", segmentIDs)
+		}
+		storage.Close()
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.Recovery().Repaired() {
+			t.Errorf("expected no repair, got %+v", storage.Recovery())
+		}
+
+		index, err := storage.Write([]byte("test data"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 5 {
+			t.Errorf("expected index to be 5, got %d", index)
+		}
+	})
+
+	t.Run("CrashAfterIndexFile", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 128,
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := writeTestLogs(t, storage, 20)
+		storage.Sync()
+
+		// keep files which are rewritten or deleted after index file
+		saved := make(map[string][]byte)
+		for _, name := range []string{metadata.MetadataFileName, "segment_0", "segment_1"} {
+			data, err := os.ReadFile(path + "/" + name)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			saved[name] = data
+		}
+
+		if err := storage.TruncateFront(10); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		storage.Close()
+
+		for name, data := range saved {
+			if err := os.WriteFile(path+"/"+name, data, 0644); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if _, err := os.Stat(path + "/segment_0"); !os.IsNotExist(err) {
+			t.Errorf("expected segment 0 to be deleted, got %v", err)
+		}
+
+		for i := 10; i < len(expected); i++ {
+			data, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !bytes.Equal(data, expected[i]) {
+				t.Errorf("expected log %d to be %v, got %v", i, expected[i], data)
+			}
+		}
+	})
+}
+
+func TestStorage_TruncateBack(t *testing.T) {
+	t.Run("Read", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 128,
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := writeTestLogs(t, storage, 20)
+		if err := storage.TruncateBack(7); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := storage.TruncateBack(10); err != nil {
+			t.Fatalf("expected no error on truncating after the last log, got %v", err)
+		}
+		if storage.LastIndex() != 7 {
+			t.Errorf("expected last index to be 7, got %d", storage.LastIndex())
+		}
+		if _, err := storage.Read(8); err == nil {
+			t.Errorf("expected error on reading removed log")
+		}
+
+		index, err := storage.Write([]byte("new data"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 8 {
+			t.Errorf("expected index to be 8, got %d", index)
+		}
+		expected = append(expected[:8], []byte("new data"))
+		storage.Close()
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.Recovery().Repaired() {
+			t.Errorf("expected no repair, got %+v", storage.Recovery())
+		}
+		if storage.LastIndex() != 8 {
+			t.Errorf("expected last index to be 8, got %d", storage.LastIndex())
+		}
+
+		for i, data := range expected {
+			readData, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !bytes.Equal(readData, data) {
+				t.Errorf("expected log %d to be %v, got %v", i, data, readData)
+			}
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		batch := [][]byte{[]byte("log 0"), []byte("log 1"), []byte("log 2"), []byte("log 3")}
+		if _, _, err := storage.WriteBatch(batch); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// truncate in the middle of batch
+		if err := storage.TruncateBack(1); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		storage.Close()
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if storage.LastIndex() != 1 {
+			t.Errorf("expected last index to be 1, got %d, %+v", storage.LastIndex(), storage.Recovery())
+		}
+		storage.Close()
+
+		report, err := Rebuild(path)
+		if err != nil || report.Err != nil {
+			t.Fatalf("expected no error, got %v, %v", err, report.Err)
+		}
+		if report.LastIndex != 1 {
+			t.Errorf("expected rebuilt last index to be 1, got %d", report.LastIndex)
+		}
+	})
+
+	t.Run("CrashAfterSegments", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 128,
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		writeTestLogs(t, storage, 20)
+		storage.Sync()
+
+		// keep files which are truncated after segments
+		saved := make(map[string][]byte)
+		for _, name := range []string{index.IndexFileName, metadata.MetadataFileName} {
+			data, err := os.ReadFile(path + "/" + name)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			saved[name] = data
+		}
+
+		if err := storage.TruncateBack(4); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		storage.Close()
+
+		for name, data := range saved {
+			if err := os.WriteFile(path+"/"+name, data, 0644); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.LastIndex() != 4 {
+			t.Errorf("expected truncated logs not to be restored, got last index %d", storage.LastIndex())
+		}
+
+		index, err := storage.Write([]byte("new data"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 5 {
+			t.Errorf("expected index to be 5, got %d", index)
+		}
+		if data, err := storage.Read(5); err != nil || string(data) != "new data" {
+			t.Errorf("expected new data, got %s, %v", data, err)
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		writeTestLogs(t, storage, 10)
+		if err := storage.TruncateFront(3); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := storage.TruncateBack(1); !errors.Is(err, ErrCompacted) {
+			t.Errorf("expected %v, got %v", ErrCompacted, err)
+		}
+
+		if err := storage.TruncateBack(2); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if storage.FirstIndex() != 3 || storage.LastIndex() != 2 {
+			t.Errorf("expected empty storage from 3, got %d to %d", storage.FirstIndex(), storage.LastIndex())
+		}
+
+		index, err := storage.Write([]byte("new data"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 3 {
+			t.Errorf("expected index to be 3, got %d", index)
+		}
+	})
+}
@@ -25,41 +25,95 @@ SOFTWARE.
 package wal
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"sync"
 
+	"github.com/ISSuh/wal/internal/crc"
 	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/file"
 	"github.com/ISSuh/wal/internal/index"
 	"github.com/ISSuh/wal/internal/metadata"
 	"github.com/ISSuh/wal/internal/segment"
 )
 
-type rollbackkey int
-
-const (
-	rollbackIndex rollbackkey = iota
-	rollbackMetadata
-	rollbackSegment
-)
+// checkpoint is the position of files before write, used to rollback failed write
+type checkpoint struct {
+	lastIndex      int64
+	metadataOffset int64
+	segmentID      int
+	segmentOffset  int64
+}
 
 type Storage interface {
 	Write(data []byte) (int64, error)
+	WriteBatch(batch [][]byte) (int64, int64, error)
 	Read(index int64) ([]byte, error)
+	View(index int64, fn func(data []byte) error) error
+	NewIterator(from int64) (Iterator, error)
+	NewReverseIterator(from int64) (Iterator, error)
+	WaitFor(ctx context.Context, index int64) error
+	Subscribe(from int64) (<-chan Entry, func() error)
+	Export(w io.Writer, from, to int64, format ExportFormat) (int64, error)
+	Import(r io.Reader) (int64, error)
+	TruncateFront(index int64) error
+	TruncateBack(index int64) error
+	FirstIndex() int64
+	LastIndex() int64
+	SyncedIndex() int64
+	Info() (Info, error)
+	HeadHash() (int64, []byte)
+	Verify(from, to int64) error
+	Recovery() RecoveryReport
 	Sync() error
 	Close() error
 }
 
 type storage struct {
 	options Options
+	codec   Codec
 
 	segment      *segment.Segment
+	segments     *segmentCache
 	indexFile    *index.File
 	metadataFile *metadata.File
 
+	// lock is held by writer to keep other writers from opening the path. nil on read only storage
+	lock *file.Lock
+
 	segmentIDCounter int
-	mutex            sync.RWMutex
+	recovery         RecoveryReport
+
+	// headHash is chaining hash of the last log. nil if the last log is not chained
+	headHash []byte
+
+	// committed is closed and replaced when logs are committed, to wake readers waiting for them.
+	// closed is closed when storage is closed.
+	committed chan struct{}
+	closed    chan struct{}
+	mutex     sync.RWMutex
+
+	// subscriptions are stopped by TruncateBack which removes logs delivered to them
+	subscriptions map[*subscription]struct{}
+
+	// committer queues concurrent writes when group commit is enabled
+	committer *groupCommitter
+
+	// syncedIndex is index of the last synced log, and unsyncedLogs is the number of logs written after
+	syncedIndex  int64
+	unsyncedLogs int
+
+	// stopSync stops background sync of SyncInterval, and syncDone is closed when it is stopped
+	stopSync chan struct{}
+	syncDone chan struct{}
+
+	// retentionTrigger wakes background retention when segment is rolled
+	retentionTrigger chan struct{}
+	stopRetention    chan struct{}
+	retentionDone    chan struct{}
 }
 
 func NewStorage(option Options) (Storage, error) {
@@ -69,76 +123,267 @@ func NewStorage(option Options) (Storage, error) {
 
 	option.setDefaultIfEmpty()
 
-	indexFile := index.NewFile(option.Path, option.SyncAfterWrite)
+	codec, err := codecOf(option.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find codec of compression. %w", err)
+	}
+
+	if option.Encryption != nil {
+		_, key, err := option.Encryption.CurrentKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current key. %w", err)
+		}
+
+		if _, err := newAEAD(key); err != nil {
+			return nil, fmt.Errorf("invalid current key. %w", err)
+		}
+	}
+
+	if option.ReadOnly {
+		return openReadOnly(option, codec)
+	}
+
+	// writer holds the lock until closed, so other writers can not interleave appends on the path
+	lock, err := lockStorage(option.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := openStorage(option, codec)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+
+	s.lock = lock
+	return s, nil
+}
+
+// openStorage opens files on path to append logs, recovering logs not fully committed by the previous process
+func openStorage(option Options, codec Codec) (*storage, error) {
+	indexFile := index.NewFile(option.Path)
+	if option.CacheIndex {
+		indexFile = index.NewCachedFile(option.Path)
+	}
 	if err := indexFile.Open(); err != nil {
 		return nil, fmt.Errorf("failed to open index file. %w", err)
 	}
 
-	metadataFile := metadata.NewFile(option.Path, option.SyncAfterWrite)
+	metadataFile := metadata.NewFile(option.Path)
+	if option.CacheMetadata {
+		metadataFile = metadata.NewCachedFile(option.Path)
+	}
 	if err := metadataFile.Open(); err != nil {
+		indexFile.Close()
 		return nil, fmt.Errorf("failed to open metadata file. %w", err)
 	}
 
-	segment, err := segment.NewSegment(0, option.Path)
+	s := &storage{
+		options:       option,
+		codec:         codec,
+		segments:      newSegmentCache(option.Path, option.MaxOpenSegments, option.MmapSegments),
+		indexFile:     indexFile,
+		metadataFile:  metadataFile,
+		committed:     make(chan struct{}),
+		closed:        make(chan struct{}),
+		subscriptions: make(map[*subscription]struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	if option.SyncPolicy.Mode == SyncInterval {
+		s.stopSync = make(chan struct{})
+		s.syncDone = make(chan struct{})
+		go s.syncPeriodically(option.SyncPolicy.Interval)
+	}
+
+	if option.Retention.enabled() {
+		s.retentionTrigger = make(chan struct{}, 1)
+		s.stopRetention = make(chan struct{})
+		s.retentionDone = make(chan struct{})
+		go s.retainPeriodically(option.Retention.Interval)
+
+		// apply retention to segments sealed before opened
+		s.triggerRetention()
+	}
+
+	if option.GroupCommit {
+		s.committer = newGroupCommitter(option.GroupCommitMaxBatch, option.GroupCommitMaxWait, s.commitBatch)
+	}
+
+	return s, nil
+}
+
+// load recovers files left by the previous process and opens the last segment to append
+func (s *storage) load() error {
+	// discard logs not fully committed by the previous process
+	report, err := s.recover()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create segment. %w", err)
+		return fmt.Errorf("failed to recover storage. %w", err)
 	}
+	s.recovery = report
 
-	return &storage{
-		options:          option,
-		segment:          segment,
-		indexFile:        indexFile,
-		metadataFile:     metadataFile,
-		segmentIDCounter: 0,
-	}, nil
+	// reopen the last segment to resume appending after the previous process
+	if err := s.openLastSegment(); err != nil {
+		return err
+	}
+
+	// finish truncation interrupted by crash
+	if err := s.compact(); err != nil {
+		return fmt.Errorf("failed to compact storage. %w", err)
+	}
+
+	if err := s.loadHeadHash(); err != nil {
+		return err
+	}
+
+	// recovered logs are synced to start with durable files
+	if err := s.syncFiles(); err != nil {
+		return fmt.Errorf("failed to sync storage. %w", err)
+	}
+	return nil
 }
 
 func (s *storage) Write(data []byte) (int64, error) {
+	newIndexSeq, _, err := s.write([][]byte{data})
+	if err != nil {
+		return 0, err
+	}
+	return newIndexSeq, nil
+}
+
+// WriteBatch writes logs of batch atomically and returns index of the first and the last log.
+// each of segment, metadata and index files is written once and synced once,
+// and logs of batch become visible all together or none of them after crash.
+func (s *storage) WriteBatch(batch [][]byte) (int64, int64, error) {
+	if len(batch) == 0 {
+		return 0, 0, newError("write", s.options.Path, ErrEmptyBatch)
+	}
+
+	return s.write(batch)
+}
+
+// write commits batch directly, or through group commit with batches of other writers
+func (s *storage) write(batch [][]byte) (int64, int64, error) {
+	if s.options.ReadOnly {
+		return 0, 0, newError("write", s.options.Path, ErrReadOnly)
+	}
+
+	if err := s.checkEntrySize(batch); err != nil {
+		return 0, 0, err
+	}
+
+	if s.committer != nil {
+		return s.committer.write(batch)
+	}
+	return s.commitBatch(batch)
+}
+
+// checkEntrySize returns ErrEntryTooLarge if any log of batch is larger than MaxEntrySize
+func (s *storage) checkEntrySize(batch [][]byte) error {
+	if s.options.MaxEntrySize <= 0 {
+		return nil
+	}
+
+	for _, data := range batch {
+		if len(data) > s.options.MaxEntrySize {
+			return newError("write", s.options.Path, fmt.Errorf("%w. size %d, limit %d", ErrEntryTooLarge, len(data), s.options.MaxEntrySize))
+		}
+	}
+	return nil
+}
+
+func (s *storage) commitBatch(batch [][]byte) (int64, int64, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	newIndexSeq := s.indexFile.LastIndex() + 1
+	if err := s.checkClosed("write"); err != nil {
+		return 0, 0, err
+	}
+
+	return s.writeBatch(batch)
+}
+
+func (s *storage) writeBatch(batch [][]byte) (int64, int64, error) {
+	cp := s.checkpoint()
+	firstIndexSeq := s.indexFile.LastIndex() + 1
 
 	// append data to segment
-	logMetadata, err := s.appendLogToSegment(newIndexSeq, data)
-	if err != nil {
-		return 0, fmt.Errorf("failed to append data to segment. %w", err)
+	head := s.headHash
+	metadataBatch := make([]metadata.Data, 0, len(batch))
+	for i, data := range batch {
+		newIndexSeq := firstIndexSeq + int64(i)
+		stored, codecID, flags, err := s.encodePayload(newIndexSeq, data)
+		if err != nil {
+			return 0, 0, s.rollback(cp, err)
+		}
+
+		if i < len(batch)-1 {
+			flags |= entry.FlagBatchContinued
+		}
+
+		logMetadata, err := s.appendLogToSegment(newIndexSeq, stored, codecID, flags)
+		if err != nil {
+			return 0, 0, s.rollback(cp, fmt.Errorf("failed to append data to segment. %w", err))
+		}
+
+		m := metadata.NewMetadata(newIndexSeq, logMetadata)
+		if s.options.HashChain {
+			head = entry.ChainHash(head, newIndexSeq, stored)
+			m = metadata.NewHashedMetadata(newIndexSeq, logMetadata, head)
+		}
+		metadataBatch = append(metadataBatch, m)
+	}
+
+	if err := s.segment.Flush(); err != nil {
+		return 0, 0, s.rollback(cp, fmt.Errorf("failed to append data to segment. %w", err))
 	}
 
 	// append metadata to metadata file
-	metadata := metadata.NewMetadata(newIndexSeq, logMetadata)
-	metadataOffset, err := s.metadataFile.Write(metadata)
+	metadataOffsets, err := s.metadataFile.WriteBatch(metadataBatch)
 	if err != nil {
-		if rollbackErr := s.rollback(rollbackIndex); rollbackErr != nil {
-			errs := errors.Join(rollbackErr, fmt.Errorf("failed to write metadata. %w", err))
-			return 0, fmt.Errorf("failed to rollback index. %w ", errs)
-		}
-		return 0, fmt.Errorf("failed to write metadata. %w", err)
+		return 0, 0, s.rollback(cp, fmt.Errorf("failed to write metadata. %w", err))
 	}
 
-	// append index to index file
-	index := index.NewIndex(newIndexSeq, metadataOffset, metadata.Size)
-	if err := s.indexFile.Write(index); err != nil {
-		if rollbackErr := s.rollback(rollbackIndex); rollbackErr != nil {
-			errs := errors.Join(rollbackErr, fmt.Errorf("failed to write metadata. %w", err))
-			return 0, fmt.Errorf("failed to rollback index. %w. %w", rollbackErr, errs)
-		}
+	// append index to index file. index file is the commit point of logs
+	indexBatch := make([]index.Index, 0, len(batch))
+	for i, m := range metadataBatch {
+		indexBatch = append(indexBatch, index.NewIndex(m.Index, metadataOffsets[i], m.Size))
+	}
 
-		if rollbackErr := s.rollback(rollbackMetadata); rollbackErr != nil {
-			errs := errors.Join(rollbackErr, fmt.Errorf("failed to write metadata. %w", err))
-			return 0, fmt.Errorf("failed to rollback metadata. %w. %w", rollbackErr, errs)
-		}
+	if err := s.indexFile.WriteBatch(indexBatch); err != nil {
+		return 0, 0, s.rollback(cp, fmt.Errorf("failed to write index. %w", err))
+	}
 
-		return 0, fmt.Errorf("failed to write index. %w", err)
+	rolled := s.segment.ID() != cp.segmentID
+	if err := s.syncAfterWrite(len(batch), rolled); err != nil {
+		return 0, 0, s.rollback(cp, err)
 	}
 
-	return newIndexSeq, nil
+	if rolled {
+		s.triggerRetention()
+	}
+
+	s.headHash = nil
+	if s.options.HashChain {
+		s.headHash = head
+	}
+
+	s.notifyCommit()
+	return firstIndexSeq, s.indexFile.LastIndex(), nil
 }
 
 func (s *storage) Read(i int64) ([]byte, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
+	if err := s.checkClosed("read"); err != nil {
+		return nil, err
+	}
+
 	// read index from index file
 	index, err := s.indexFile.Read(i)
 	if err != nil {
@@ -152,7 +397,7 @@ func (s *storage) Read(i int64) ([]byte, error) {
 	}
 
 	// read data from segment
-	data, err := s.readLogFromSegment(metadata.LogMetadata)
+	data, err := s.readLogFromSegment(i, metadata.LogMetadata)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read data from segment. %w", err)
 	}
@@ -160,68 +405,208 @@ func (s *storage) Read(i int64) ([]byte, error) {
 	return data, nil
 }
 
+// View calls fn with data of log of index without copying it from mapped segment.
+// data is valid only until fn returns and must not be modified. storage is locked for reading while fn runs,
+// so fn must not write, truncate or close storage.
+// data is copied if segment is not mapped, log is split over segments, compressed or encrypted.
+func (s *storage) View(i int64, fn func(data []byte) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if err := s.checkClosed("view"); err != nil {
+		return err
+	}
+
+	index, err := s.indexFile.Read(i)
+	if err != nil {
+		return fmt.Errorf("failed to read index. %w", err)
+	}
+
+	metadata, err := s.readMetadata(index)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata. %w", err)
+	}
+
+	if len(metadata.LogMetadata) != 1 {
+		data, err := s.readLogFromSegment(i, metadata.LogMetadata)
+		if err != nil {
+			return fmt.Errorf("failed to read data from segment. %w", err)
+		}
+		return fn(data)
+	}
+
+	m := metadata.LogMetadata[0]
+	called := false
+	err = s.viewLog(m, func(log entry.Log) error {
+		if !s.options.SkipCRCVerification && !crc.IsMatch(log.PayLoad, m.CRC) {
+			return corruptionError(s.options.Path, i, m)
+		}
+
+		data, err := decodePayload(s.options.Path, i, m, log, log.PayLoad, s.options.Encryption)
+		if err != nil {
+			return err
+		}
+
+		called = true
+		return fn(data)
+	})
+
+	// error of fn is returned as it is
+	if err != nil && !called {
+		return fmt.Errorf("failed to read data from segment. %w", readLogError(s.options.Path, i, m, err))
+	}
+	return err
+}
+
+// FirstIndex returns index of the first log. logs before it were removed by TruncateFront
+func (s *storage) FirstIndex() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.indexFile.FirstIndex()
+}
+
+// LastIndex returns index of the last written log. returns FirstIndex - 1 if storage is empty
+func (s *storage) LastIndex() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.indexFile.LastIndex()
+}
+
+// Recovery returns what was discarded from the tail of storage when storage was opened
+func (s *storage) Recovery() RecoveryReport {
+	return s.recovery
+}
+
+// Sync syncs all files regardless of sync policy
 func (s *storage) Sync() error {
+	if s.options.ReadOnly {
+		return newError("sync", s.options.Path, ErrReadOnly)
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if err := s.segment.Sync(); err != nil {
-		return fmt.Errorf("failed to sync segment. %w", err)
+	if err := s.checkClosed("sync"); err != nil {
+		return err
 	}
+	return s.syncFiles()
+}
 
-	if err := s.indexFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync index file. %w", err)
+// Close waits for in-flight operations, syncs files unless sync policy is SyncNever and closes every file.
+// readers waiting for logs are woken, and every call returning error after Close returns ErrClosed.
+// FirstIndex, LastIndex and other methods without error keep returning values at Close.
+func (s *storage) Close() error {
+	// operations in-flight hold the lock, so marking closed waits for them
+	s.mutex.Lock()
+	if err := s.checkClosed("close"); err != nil {
+		s.mutex.Unlock()
+		return err
 	}
+	close(s.closed)
+	s.mutex.Unlock()
 
-	if err := s.metadataFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync metadata file. %w", err)
+	// background goroutines take the lock, so they are stopped without holding it
+	if s.stopSync != nil {
+		close(s.stopSync)
+		<-s.syncDone
 	}
 
-	return nil
-}
+	if s.stopRetention != nil {
+		close(s.stopRetention)
+		<-s.retentionDone
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var errs []error
+	if !s.options.ReadOnly && s.options.SyncPolicy.Mode != SyncNever && s.syncedIndex < s.indexFile.LastIndex() {
+		if err := s.syncFiles(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// every handle is released even if closing one of them fails
+	if err := s.segments.close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close cached segments. %w", err))
+	}
 
-// closes storage
-func (s *storage) Close() error {
 	if err := s.segment.Close(); err != nil {
-		return fmt.Errorf("failed to close segment. %w", err)
+		errs = append(errs, fmt.Errorf("failed to close segment. %w", err))
 	}
 
 	if err := s.indexFile.Close(); err != nil {
-		return fmt.Errorf("failed to close index file. %w", err)
+		errs = append(errs, fmt.Errorf("failed to close index file. %w", err))
 	}
 
 	if err := s.metadataFile.Close(); err != nil {
-		return fmt.Errorf("failed to close metadata file. %w", err)
+		errs = append(errs, fmt.Errorf("failed to close metadata file. %w", err))
 	}
 
-	return nil
+	if s.lock != nil {
+		if err := s.lock.Unlock(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unlock storage. %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkClosed returns ErrClosed of op if storage is closed. storage must be locked.
+func (s *storage) checkClosed(op string) error {
+	select {
+	case <-s.closed:
+		return newError(op, s.options.Path, ErrClosed)
+	default:
+		return nil
+	}
 }
 
 // calculateOffsetFromData calculates offset of data and need new segment after append
 func (s *storage) calculateOffsetFromData(len int) (int, bool) {
-	offset := 0
-	needNewSegmentAfterAppend := false
-	switch {
-	case len > s.options.SegmentFileSize:
-		offset = s.options.SegmentFileSize
-		needNewSegmentAfterAppend = true
-	case len+s.segment.Size() > s.options.SegmentFileSize:
-		offset = s.options.SegmentFileSize - s.segment.Size()
-		needNewSegmentAfterAppend = true
-	default:
-		offset = len
+	available := s.options.SegmentFileSize - s.segment.Size() - entry.LogHeaderByteLen
+	if available < 1 {
+		// segment file size is too small to hold log header.
+		// append at least one byte on each segment to make progress.
+		available = 1
 	}
 
-	return offset, needNewSegmentAfterAppend
+	if len >= available {
+		return available, true
+	}
+	return len, s.segmentFull(s.segment.Size() + entry.LogHeaderByteLen + len)
 }
 
-// appendLogToSegment appends log to segment
-func (s *storage) appendLogToSegment(newIndex int64, data []byte) ([]entry.LogMetadata, error) {
+// encodePayload compresses data and encrypts it if key provider is set.
+// returns stored payload with codec and flags of it.
+func (s *storage) encodePayload(i int64, data []byte) ([]byte, CodecID, uint8, error) {
+	stored, codecID, err := compress(s.codec, data)
+	if err != nil {
+		return nil, CodecNone, 0, err
+	}
+
+	if s.options.Encryption == nil {
+		return stored, codecID, 0, nil
+	}
+
+	encrypted, err := encrypt(s.options.Encryption, i, stored)
+	if err != nil {
+		return nil, CodecNone, 0, fmt.Errorf("failed to encrypt data. %w", err)
+	}
+	return encrypted, codecID, entry.FlagEncrypted, nil
+}
+
+// appendLogToSegment appends log to segment. data is payload compressed by codec of codecID.
+// flags are set on every fragment of log, which mark encrypted payload or log followed by another log of the same batch.
+func (s *storage) appendLogToSegment(newIndex int64, data []byte, codecID CodecID, flags uint8) ([]entry.LogMetadata, error) {
 	prevIndex, index := 0, 0
 	dataSize := len(data)
 	remainedDataSize := dataSize
 	sequence := 0
 	segmentMetadata := make([]entry.LogMetadata, 0)
-	for index < dataSize {
+
+	// empty data is appended as a single empty log to keep segment self-describing
+	for sequence == 0 || index < dataSize {
 		// calculate offset of data
 		offset, needNewSegmentAfterAppend := s.calculateOffsetFromData(remainedDataSize)
 		prevIndex = index
@@ -230,24 +615,25 @@ func (s *storage) appendLogToSegment(newIndex int64, data []byte) ([]entry.LogMe
 		// create log
 		partaialData := data[prevIndex:index]
 		log := entry.NewLog(newIndex, sequence, partaialData)
+		log.Codec = uint8(codecID)
+		log.Flags = flags
+		if prevIndex == 0 {
+			log.Flags |= entry.FlagFirstFragment
+		}
+		if index == dataSize {
+			log.Flags |= entry.FlagLastFragment
+		}
 
 		// append log to segment
-		m, err := s.segment.Append(log)
+		m, err := s.segment.Buffer(log)
 		if err != nil {
 			return nil, fmt.Errorf("failed to append log to segment. %w", err)
 		}
 
 		if needNewSegmentAfterAppend {
-			s.segmentIDCounter++
-
-			// create new segment
-			segment, err := segment.NewSegment(s.segmentIDCounter, s.options.Path)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create new segment. %w", err)
+			if err := s.rollSegment(); err != nil {
+				return nil, err
 			}
-
-			// switch segment
-			s.segment = segment
 		}
 
 		remainedDataSize = len(data[index:])
@@ -258,15 +644,89 @@ func (s *storage) appendLogToSegment(newIndex int64, data []byte) ([]entry.LogMe
 	return segmentMetadata, nil
 }
 
+// openLastSegment opens the last segment on path as current segment to append logs
+func (s *storage) openLastSegment() error {
+	segmentIDs, err := segment.List(s.options.Path)
+	if err != nil {
+		return fmt.Errorf("failed to list segments. %w", err)
+	}
+
+	segmentID := 0
+	if len(segmentIDs) > 0 {
+		segmentID = segmentIDs[len(segmentIDs)-1]
+	}
+
+	seg, err := segment.NewSegment(segmentID, s.options.Path)
+	if err != nil {
+		return fmt.Errorf("failed to create segment. %w", err)
+	}
+
+	// logs are appended only on segment of current format
+	s.segment = seg
+	s.segmentIDCounter = segmentID
+	if seg.Version() == segment.LegacyVersion || (!seg.Empty() && s.segmentFull(seg.Size())) {
+		if err := s.rollSegment(); err != nil {
+			return fmt.Errorf("failed to roll segment. %w", err)
+		}
+	}
+	return nil
+}
+
+// segmentFull reports whether segment of size has no room for another log
+func (s *storage) segmentFull(size int) bool {
+	return size+entry.LogHeaderByteLen >= s.options.SegmentFileSize
+}
+
+// rollSegment seals current segment and switches to new segment
+func (s *storage) rollSegment() error {
+	if err := s.segment.Flush(); err != nil {
+		return fmt.Errorf("failed to flush segment. %w", err)
+	}
+
+	// sealed segment is closed, so it is synced now unless syncing is left to os
+	if s.options.SyncPolicy.Mode != SyncNever {
+		if err := s.segment.Sync(); err != nil {
+			return fmt.Errorf("failed to sync segment. %w", err)
+		}
+	}
+
+	// create new segment
+	segment, err := segment.NewSegment(s.segmentIDCounter+1, s.options.Path)
+	if err != nil {
+		return fmt.Errorf("failed to create new segment. %w", err)
+	}
+
+	// switch segment
+	sealed := s.segment
+	s.segmentIDCounter++
+	s.segment = segment
+
+	if err := sealed.Close(); err != nil {
+		return fmt.Errorf("failed to close sealed segment. %w", err)
+	}
+	return nil
+}
+
 // readMetadata reads metadata from metadata file
 func (s *storage) readMetadata(index index.Index) (metadata.Data, error) {
 	offset := index.MetadataOffset
 	size := index.MetadataSize
 	data, err := s.metadataFile.Read(offset, size)
 	if err != nil {
+		var metadataErr *Error
+		if errors.As(err, &metadataErr) {
+			metadataErr.WithIndex(index.Index)
+		}
 		return metadata.Data{}, fmt.Errorf("failed to read metadata. %w", err)
 	}
 
+	// metadata does not match with index if files were replaced separately
+	if data.Index != index.Index {
+		metadataPath := fmt.Sprintf("%s/%s", s.options.Path, metadata.MetadataFileName)
+		err := fmt.Errorf("%w. metadata at %d is of log %d", ErrCorrupted, offset, data.Index)
+		return metadata.Data{}, newError("read", metadataPath, err).WithIndex(index.Index)
+	}
+
 	// sort metadata by sequence
 	sort.Slice(data.LogMetadata, func(i, j int) bool {
 		return data.LogMetadata[i].Sequence < data.LogMetadata[j].Sequence
@@ -275,38 +735,173 @@ func (s *storage) readMetadata(index index.Index) (metadata.Data, error) {
 	return data, nil
 }
 
+// readMetadataOfIndex reads metadata of index i
+func (s *storage) readMetadataOfIndex(i int64) (metadata.Data, error) {
+	index, err := s.indexFile.Read(i)
+	if err != nil {
+		return metadata.Data{}, fmt.Errorf("failed to read index. %w", err)
+	}
+	return s.readMetadata(index)
+}
+
 // readLogFromSegment reads log from segment
-func (s *storage) readLogFromSegment(logMetadata []entry.LogMetadata) ([]byte, error) {
-	data := make([]byte, 0)
+func (s *storage) readLogFromSegment(i int64, logMetadata []entry.LogMetadata) ([]byte, error) {
+	logs := make([]entry.Log, 0, len(logMetadata))
 	for _, m := range logMetadata {
-		// open segment if segment id is different
-		seg := s.segment
-		if m.SegmentID != s.segment.ID() {
-			var err error
-			seg, err = segment.NewSegment(m.SegmentID, s.options.Path)
-			if err != nil {
-				return nil, fmt.Errorf("failed to open segment. %w", err)
-			}
+		log, err := s.readLog(m)
+		if err != nil {
+			return nil, readLogError(s.options.Path, i, m, err)
 		}
 
-		log, err := seg.Read(m.Offset, m.Size)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read log. %w", err)
+		logs = append(logs, log)
+	}
+
+	return assembleLog(s.options.Path, i, logMetadata, logs, !s.options.SkipCRCVerification, s.options.Encryption)
+}
+
+// readLog reads fragment of log from the active segment or cached handle of sealed segment
+func (s *storage) readLog(m entry.LogMetadata) (entry.Log, error) {
+	if m.SegmentID == s.segment.ID() {
+		return s.segment.Read(m.Offset, m.Size)
+	}
+
+	seg, err := s.segments.get(m.SegmentID)
+	if err != nil {
+		return entry.Log{}, err
+	}
+	defer s.segments.release(seg)
+
+	return seg.Read(m.Offset, m.Size)
+}
+
+// viewLog calls fn with fragment of log on the active segment or cached handle of sealed segment.
+// cached handle is held until fn returns, so its mapping is not unmapped while used.
+func (s *storage) viewLog(m entry.LogMetadata, fn func(entry.Log) error) error {
+	if m.SegmentID == s.segment.ID() {
+		return s.segment.View(m.Offset, m.Size, fn)
+	}
+
+	seg, err := s.segments.get(m.SegmentID)
+	if err != nil {
+		return err
+	}
+	defer s.segments.release(seg)
+
+	return seg.View(m.Offset, m.Size, fn)
+}
+
+// removeSegment removes segment file of id and its cached handle
+func (s *storage) removeSegment(id int) error {
+	s.segments.remove(id)
+	return segment.Remove(id, s.options.Path)
+}
+
+// readLogError converts error while reading log of index i to Error, which wraps ErrCorrupted if log is broken
+func readLogError(path string, i int64, m entry.LogMetadata, err error) error {
+	if errors.Is(err, entry.ErrInvalidLog) {
+		return corruptionError(path, i, m)
+	}
+
+	var segmentErr *Error
+	if errors.As(err, &segmentErr) {
+		segmentErr.WithIndex(i)
+	}
+	return fmt.Errorf("failed to read log. %w", err)
+}
+
+// assembleLog verifies crc of fragments of log, concatenates their payload and decodes it
+func assembleLog(path string, i int64, logMetadata []entry.LogMetadata, logs []entry.Log, verify bool, keys KeyProvider) ([]byte, error) {
+	size := 0
+	for _, m := range logMetadata {
+		size += m.Size
+	}
+
+	data := make([]byte, 0, size)
+	for j, m := range logMetadata {
+		log := logs[j]
+		if verify && !crc.IsMatch(log.PayLoad, m.CRC) {
+			return nil, corruptionError(path, i, m)
 		}
 
 		data = append(data, log.PayLoad...)
 	}
 
-	return data, nil
+	return decodePayload(path, i, logMetadata[0], logs[0], data, keys)
 }
 
-func (s *storage) rollback(key rollbackkey) error {
-	switch key {
-	case rollbackIndex:
-		return s.indexFile.Rollback()
-	case rollbackMetadata:
-		return s.metadataFile.Rollback()
-	default:
-		return nil
+// decodePayload decrypts and decompresses stored payload of log of which header is log.
+// payload which can not be authenticated or decompressed is treated as corrupted.
+func decodePayload(path string, i int64, m entry.LogMetadata, log entry.Log, data []byte, keys KeyProvider) ([]byte, error) {
+	if log.IsEncrypted() {
+		decrypted, err := decrypt(keys, i, data)
+		switch {
+		case errors.Is(err, ErrCorrupted):
+			return nil, corruptionError(path, i, m)
+		case err != nil:
+			return nil, fmt.Errorf("failed to decrypt log %d. %w", i, err)
+		}
+		data = decrypted
+	}
+
+	decompressed, err := decompress(CodecID(log.Codec), data)
+	switch {
+	case errors.Is(err, ErrUnknownCodec):
+		return nil, fmt.Errorf("failed to decompress log %d. %w", i, err)
+	case err != nil:
+		return nil, corruptionError(path, i, m)
+	}
+	return decompressed, nil
+}
+
+// checkpoint returns current position of files
+func (s *storage) checkpoint() checkpoint {
+	return checkpoint{
+		lastIndex:      s.indexFile.LastIndex(),
+		metadataOffset: s.metadataFile.LastOffset(),
+		segmentID:      s.segment.ID(),
+		segmentOffset:  s.segment.Offset(),
+	}
+}
+
+// rollback restores index, metadata and segment files to checkpoint after failed write.
+// segments created after checkpoint are removed.
+func (s *storage) rollback(cp checkpoint, cause error) error {
+	errs := []error{cause}
+	if err := s.indexFile.TruncateBack(cp.lastIndex); err != nil {
+		errs = append(errs, fmt.Errorf("failed to rollback index. %w", err))
 	}
+
+	if err := s.metadataFile.Truncate(cp.metadataOffset); err != nil {
+		errs = append(errs, fmt.Errorf("failed to rollback metadata. %w", err))
+	}
+
+	if err := s.rollbackSegment(cp); err != nil {
+		errs = append(errs, fmt.Errorf("failed to rollback segment. %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *storage) rollbackSegment(cp checkpoint) error {
+	if s.segment.ID() != cp.segmentID {
+		if err := s.segment.Close(); err != nil {
+			return err
+		}
+
+		for id := s.segmentIDCounter; id > cp.segmentID; id-- {
+			if err := s.removeSegment(id); err != nil {
+				return err
+			}
+		}
+
+		seg, err := segment.NewSegment(cp.segmentID, s.options.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open segment. %w", err)
+		}
+
+		s.segment = seg
+		s.segmentIDCounter = cp.segmentID
+	}
+
+	return s.segment.Truncate(cp.segmentOffset)
 }
@@ -25,8 +25,17 @@ SOFTWARE.
 package wal
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
+
+	"github.com/ISSuh/wal/internal/crc"
+	"github.com/ISSuh/wal/internal/entry"
+	"github.com/ISSuh/wal/internal/index"
+	"github.com/ISSuh/wal/internal/metadata"
 )
 
 func createTempDir(path string) {
@@ -251,6 +260,387 @@ func TestStorage_Read(t *testing.T) {
 	})
 }
 
+func TestStorage_ReadCorrupted(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, data := range []string{"test data1", "test data2"} {
+		if _, err := storage.Write([]byte(data)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// flip a byte of the first log
+	content, err := os.ReadFile(path + "/segment_0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	payloadOffset := bytes.Index(content, []byte("test data1"))
+
+	f, err := os.OpenFile(path+"/segment_0", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := f.WriteAt([]byte("x"), int64(payloadOffset)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	f.Close()
+
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err = storage.Read(0)
+	if !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+
+	var corruptionErr *Error
+	if !errors.As(err, &corruptionErr) {
+		t.Fatalf("expected Error, got %v", err)
+	}
+	expectedOffset := int64(payloadOffset - entry.LogHeaderByteLen)
+	if corruptionErr.Index != 0 || corruptionErr.SegmentID != 0 || corruptionErr.Offset != expectedOffset || corruptionErr.Path != path+"/segment_0" {
+		t.Errorf("unexpected corruption error %+v", corruptionErr)
+	}
+
+	if _, err := storage.Read(1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	storage.Close()
+
+	options.SkipCRCVerification = true
+	storage, err = NewStorage(options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	readData, err := storage.Read(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "xest data1" {
+		t.Errorf("expected data to be 'xest data1', got %s", string(readData))
+	}
+}
+
+func TestStorage_Reopen(t *testing.T) {
+	t.Run("Reopen_1", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := storage.Write([]byte("test data1")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := storage.Close(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.LastIndex() != 0 {
+			t.Errorf("expected last index to be 0, got %d", storage.LastIndex())
+		}
+
+		index, err := storage.Write([]byte("test data2"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 1 {
+			t.Errorf("expected index to be 1, got %d", index)
+		}
+
+		readData1, err := storage.Read(0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData1) != "test data1" {
+			t.Errorf("expected data to be 'test data1', got %s", string(readData1))
+		}
+
+		readData2, err := storage.Read(1)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(readData2) != "test data2" {
+			t.Errorf("expected data to be 'test data2', got %s", string(readData2))
+		}
+	})
+
+	t.Run("Reopen_2", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 10,
+		}
+
+		expected := []string{"aaaaaaaaaabbbb", "ccccc", "dddddddddd", "eeeeeeeeeeeeeeeeeeeeeee"}
+		for i, data := range expected {
+			storage, err := NewStorage(options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			index, err := storage.Write([]byte(data))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if index != int64(i) {
+				t.Errorf("expected index to be %d, got %d", i, index)
+			}
+
+			if err := storage.Close(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		for i, data := range expected {
+			readData, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(readData) != data {
+				t.Errorf("expected data to be '%s', got %s", data, string(readData))
+			}
+		}
+	})
+}
+
+func TestStorage_LegacySegment(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	// headerless segment written by previous version
+	data := []byte("legacy data")
+	if err := os.WriteFile(path+"/segment_0", data, 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	m := metadata.NewMetadata(0, []entry.LogMetadata{
+		{SegmentID: 0, Size: len(data), Sequence: 0, CRC: crc.Encode(data), Offset: 0},
+	})
+	if err := os.WriteFile(path+"/metadata", metadata.EncodeMetadata(m), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	i := index.NewIndex(0, 0, m.Size)
+	if err := os.WriteFile(path+"/index", index.EncodeIndex(i), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	readData, err := storage.Read(0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "legacy data" {
+		t.Errorf("expected data to be 'legacy data', got %s", string(readData))
+	}
+
+	newIndex, err := storage.Write([]byte("test data"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if newIndex != 1 {
+		t.Errorf("expected index to be 1, got %d", newIndex)
+	}
+
+	readData, err = storage.Read(newIndex)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(readData) != "test data" {
+		t.Errorf("expected data to be 'test data', got %s", string(readData))
+	}
+
+	if _, err := os.Stat(path + "/segment_1"); err != nil {
+		t.Errorf("expected new log to be appended on segment_1, got %v", err)
+	}
+}
+
+func TestStorage_WriteBatch(t *testing.T) {
+	t.Run("Read", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 256,
+		}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if _, _, err := storage.WriteBatch(nil); err == nil {
+			t.Fatalf("expected error on empty batch")
+		}
+
+		expected := make([][]byte, 0)
+		for i := 0; i < 3; i++ {
+			batch := [][]byte{
+				[]byte(fmt.Sprintf("log %d-0", i)),
+				bytes.Repeat([]byte{byte(i)}, 300),
+				{},
+				[]byte(fmt.Sprintf("log %d-3", i)),
+			}
+
+			first, last, err := storage.WriteBatch(batch)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if first != int64(len(expected)) || last != first+int64(len(batch))-1 {
+				t.Fatalf("expected batch %d - %d, got %d - %d", len(expected), len(expected)+len(batch)-1, first, last)
+			}
+			expected = append(expected, batch...)
+		}
+
+		for i, data := range expected {
+			read, err := storage.Read(int64(i))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !bytes.Equal(read, data) {
+				t.Errorf("expected log %d to be %v, got %v", i, data, read)
+			}
+		}
+	})
+
+	t.Run("CutIndexFile", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{Path: path}
+		storage, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := storage.Write([]byte("log 0")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, _, err := storage.WriteBatch([][]byte{[]byte("log 1"), []byte("log 2"), []byte("log 3")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		storage.Close()
+
+		// crash after the first index of batch is written next to header and log 0
+		if err := os.Truncate(path+"/"+index.IndexFileName, 3*20); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		storage, err = NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer storage.Close()
+
+		if storage.LastIndex() != 0 {
+			t.Fatalf("expected incomplete batch to be discarded, got last index %d", storage.LastIndex())
+		}
+		if report := storage.Recovery(); report.DiscardedLogs != 1 {
+			t.Errorf("expected 1 discarded log, got %+v", report)
+		}
+
+		index, err := storage.Write([]byte("log 1"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 1 {
+			t.Errorf("expected index to be 1, got %d", index)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		path := "./tmp"
+		createTempDir(path)
+		defer deleteAllFilesOnDir(path)
+
+		options := Options{
+			Path:            path,
+			SegmentFileSize: 64,
+		}
+		st, err := NewStorage(options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer st.Close()
+
+		s := st.(*storage)
+		if _, err := s.Write([]byte("log 0")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cp := s.checkpoint()
+		sizes := fileSizesOnDir(t, path)
+
+		if _, _, err := s.WriteBatch([][]byte{bytes.Repeat([]byte("1"), 200), []byte("log 2")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cause := errors.New("failed")
+		if err := s.rollback(cp, cause); !errors.Is(err, cause) {
+			t.Fatalf("expected cause of rollback, got %v", err)
+		}
+
+		if s.LastIndex() != 0 {
+			t.Errorf("expected last index to be 0, got %d", s.LastIndex())
+		}
+		if rolledBack := fileSizesOnDir(t, path); !reflect.DeepEqual(rolledBack, sizes) {
+			t.Errorf("expected files to be %v, got %v", sizes, rolledBack)
+		}
+
+		index, err := s.Write([]byte("log 1"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if index != 1 {
+			t.Errorf("expected index to be 1, got %d", index)
+		}
+	})
+}
+
 func TestStorage_Close(t *testing.T) {
 	path := "./tmp"
 	createTempDir(path)
@@ -310,6 +700,31 @@ func BenchmarkWriteWithSyncAfterWrite(b *testing.B) {
 	}
 }
 
+func BenchmarkWriteBatch(b *testing.B) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	options := Options{Path: path}
+	storage, err := NewStorage(options)
+	if err != nil {
+		b.Fatalf("expected no error, got %v", err)
+	}
+
+	batch := make([][]byte, 64)
+	for i := range batch {
+		batch[i] = []byte("1")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := storage.WriteBatch(batch)
+		if err != nil {
+			b.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
+
 func BenchmarkRead(b *testing.B) {
 	path := "./tmp"
 	createTempDir(path)
@@ -335,3 +750,79 @@ func BenchmarkRead(b *testing.B) {
 		}
 	}
 }
+
+func TestNewStorage_CloseFilesOnFailure(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("can not count opened files")
+		}
+		return len(entries)
+	}
+
+	storage, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	writeTestLogs(t, storage, 3)
+	storage.Close()
+
+	// the last segment can not be opened
+	if err := os.Symlink("notexist/segment_9", path+"/segment_9"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	before := openFiles()
+	if _, err := NewStorage(Options{Path: path}); err == nil {
+		t.Fatalf("expected error on segment which can not be opened")
+	}
+	if after := openFiles(); after != before {
+		t.Errorf("expected %d opened files, got %d", before, after)
+	}
+
+	if err := os.Remove(path + "/segment_9"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	storage, err = NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer storage.Close()
+
+	if storage.LastIndex() != 2 {
+		t.Errorf("expected last index to be 2, got %d", storage.LastIndex())
+	}
+}
+
+func TestStorage_ReadMismatchedMetadata(t *testing.T) {
+	path := "./tmp"
+	createTempDir(path)
+	defer deleteAllFilesOnDir(path)
+
+	st, err := NewStorage(Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer st.Close()
+
+	writeTestLogs(t, st, 2)
+
+	// index of log 0 pointing metadata of log 1
+	s := st.(*storage)
+	i, err := s.indexFile.Read(1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	i.Index = 0
+
+	_, err = s.readMetadata(i)
+	var walErr *Error
+	if !errors.Is(err, ErrCorrupted) || !errors.As(err, &walErr) || walErr.Index != 0 {
+		t.Errorf("expected %v of log 0, got %v", ErrCorrupted, err)
+	}
+}